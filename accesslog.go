@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rotatingFile is a concurrency-safe append-only file that rotates once it grows past
+// maxSize bytes, keeping up to backups older copies as path.1 (newest) ... path.N.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+// openRotatingFile opens (or creates) path for appending.
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file, rf.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would push the file past maxSize.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N-1 to path.N and so on, moves the current file to path.1 and
+// starts a new one. The caller must hold rf.mu.
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	if rf.backups > 0 {
+		for i := rf.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(rf.path); err != nil {
+		return err
+	}
+	return rf.open()
+}
+
+// Close flushes and closes the file. Further writes fail.
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Sync()
+	if cerr := rf.file.Close(); err == nil {
+		err = cerr
+	}
+	rf.file = nil
+	return err
+}
+
+// accessLog receives one JSON line per request when ACCESS_LOG_FILE is set; nil otherwise.
+var accessLog *rotatingFile
+
+// accessLogEntry is the request metadata recorded in the access log. Bodies are never logged.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// writeAccessLog appends e to the access log, if one is configured.
+func writeAccessLog(e accessLogEntry) {
+	if accessLog == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	accessLog.Write(append(line, '\n'))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// countLines returns the number of lines in the file at path, or 0 when it doesn't exist.
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for s := bufio.NewScanner(f); s.Scan(); n++ {
+	}
+	return n
+}
+
+func TestRotatingFileRotatesPastMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := openRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatalf("openRotatingFile: %v", err)
+	}
+	line := []byte(fmt.Sprintf("%039d\n", 0)) // 40 bytes, so two fit per file
+	for i := 0; i < 7; i++ {
+		if _, err := rf.Write(line); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	for name, want := range map[string]int{path: 1, path + ".1": 2, path + ".2": 2, path + ".3": 0} {
+		if got := countLines(t, name); got != want {
+			t.Errorf("%s has %d lines, want %d", filepath.Base(name), got, want)
+		}
+	}
+	if info, _ := os.Stat(path + ".1"); info.Size() > 100 {
+		t.Errorf("rotated file is %d bytes, over the 100 byte limit", info.Size())
+	}
+	if _, err := rf.Write(line); err == nil {
+		t.Error("write after Close succeeded")
+	}
+}
+
+func TestAccessLogIsConcurrencySafe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := openRotatingFile(path, 0, 0)
+	if err != nil {
+		t.Fatalf("openRotatingFile: %v", err)
+	}
+	accessLog = rf
+	t.Cleanup(func() { accessLog = nil })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			writeAccessLog(accessLogEntry{Method: "GET", Path: fmt.Sprintf("/r/%d", i), Status: 200})
+		}(i)
+	}
+	wg.Wait()
+	rf.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for s := bufio.NewScanner(f); s.Scan(); n++ {
+		var e accessLogEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("line %d is not a JSON entry: %q", n, s.Text())
+		}
+	}
+	if n != 50 {
+		t.Errorf("access log has %d entries, want 50", n)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// adminAuthorized reports whether r carries the ADMIN_TOKEN as a bearer token. Admin
+// endpoints are disabled entirely while ADMIN_TOKEN is unset.
+func adminAuthorized(r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return false
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// handleCacheFlush serves POST /admin/cache/flush: it clears the restaurant, time zone
+// and response caches and reports how many entries each held. The location query
+// parameter limits the flush to that location.
+func handleCacheFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	area := ""
+	if location := r.URL.Query().Get("location"); location != "" {
+		area = searchArea{Name: location}.key()
+	}
+	cleared := map[string]int{
+		"restaurants": cache.flush(area),
+		"timezones":   zones.flush(area),
+		"responses":   responses.flush(area),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"cleared": cleared})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// flushCache sends POST /admin/cache/flush with query and the bearer token, if any.
+func flushCache(t *testing.T, method, query, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/admin/cache/flush?"+query, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handleCacheFlush(rec, req)
+	return rec
+}
+
+func TestCacheFlushRequiresAuth(t *testing.T) {
+	if rec := flushCache(t, http.MethodPost, "", "anything"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without ADMIN_TOKEN: status %d, want 401", rec.Code)
+	}
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	for _, token := range []string{"", "wrong"} {
+		if rec := flushCache(t, http.MethodPost, "", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d, want 401", token, rec.Code)
+		}
+	}
+	if rec := flushCache(t, http.MethodGet, "", "s3cret"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", rec.Code)
+	}
+}
+
+func TestCacheFlushClearsEntries(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	cache.flush("")
+	zones.flush("")
+	responses.flush("")
+	t.Cleanup(func() {
+		cache.flush("")
+		zones.flush("")
+		responses.flush("")
+	})
+	sf, oak := searchArea{Name: "San Francisco"}, searchArea{Name: "Oakland"}
+	for _, area := range []searchArea{sf, oak} {
+		cache.set(cacheKey(stubProvider, area), []Restaurant{{Name: "A"}}, time.Minute)
+		areaLocation(area, []Restaurant{{Timezone: "America/Los_Angeles"}})
+		responses.set("key-"+area.key(), area.key(), []byte("{}"), time.Minute)
+	}
+
+	rec := flushCache(t, http.MethodPost, "location=Oakland", "s3cret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := map[string]interface{}{"restaurants": 1.0, "timezones": 1.0, "responses": 1.0}
+	if got := decodeJSON(t, rec)["cleared"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("cleared = %v, want %v", got, want)
+	}
+	if _, _, ok := cache.get(cacheKey(stubProvider, sf)); !ok {
+		t.Error("flushing Oakland cleared San Francisco")
+	}
+
+	rec = flushCache(t, http.MethodPost, "", "s3cret")
+	if got := decodeJSON(t, rec)["cleared"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("full flush cleared = %v, want the remaining %v", got, want)
+	}
+	if cache.size() != 0 {
+		t.Errorf("%d restaurant entries left after a full flush", cache.size())
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Alternative is a restaurant the model considered but didn't pick.
+type Alternative struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// maxAlternatives caps how many alternatives are returned.
+const maxAlternatives = 3
+
+// alternativesInstruction asks the model to end its answer with a parseable alternatives tail.
+const alternativesInstruction = "\nAfter your recommendation, add a line reading exactly \"Alternatives:\" followed by " +
+	"2 to 3 lines of the form \"- <restaurant name>: <one-line reason>\" for options you considered but didn't pick."
+
+var (
+	alternativesHeader = regexp.MustCompile(`(?im)^\s*\**alternatives\**:?\**\s*$`)
+	alternativeLine    = regexp.MustCompile(`^\s*[-*\d.]+\s*\**([^:*]+?)\**\s*[:\x{2013}\x{2014}-]\s*(.+)$`)
+)
+
+// parseAlternatives splits a trailing "Alternatives:" section off content. It returns the
+// content without that section and the parsed alternatives, or content unchanged and nil
+// if no well-formed section is found.
+func parseAlternatives(content string) (string, []Alternative) {
+	locs := alternativesHeader.FindAllStringIndex(content, -1)
+	if len(locs) == 0 {
+		return content, nil
+	}
+	last := locs[len(locs)-1]
+
+	var alts []Alternative
+	for _, line := range strings.Split(content[last[1]:], "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m := alternativeLine.FindStringSubmatch(line)
+		if m == nil {
+			break
+		}
+		alts = append(alts, Alternative{Name: strings.TrimSpace(m[1]), Reason: strings.TrimSpace(m[2])})
+		if len(alts) == maxAlternatives {
+			break
+		}
+	}
+	if len(alts) == 0 {
+		return content, nil
+	}
+	return strings.TrimSpace(content[:last[0]]), alts
+}
+
+// computeAlternatives derives alternatives from the ranked candidates when the model
+// didn't supply them: the pick is whichever candidate the content mentions first (or the
+// top-ranked one), and the alternatives are the next best-ranked of the rest.
+func computeAlternatives(restaurants []Restaurant, content string, units string) []Alternative {
+	if len(restaurants) < 2 {
+		return nil
+	}
+	pick := mentionedFirst(restaurants, content)
+	if pick < 0 {
+		pick = 0
+	}
+
+	var alts []Alternative
+	for i, r := range restaurants {
+		if i == pick {
+			continue
+		}
+		reason := fmt.Sprintf("rated %.1f, %s away, about $%.0f", r.Rating, formatDistance(r.Distance, units), r.Price)
+		if !geocodingEnabled() {
+			reason = fmt.Sprintf("rated %.1f, about $%.0f", r.Rating, r.Price)
+		}
+		alts = append(alts, Alternative{Name: r.Name, Reason: reason})
+		if len(alts) == maxAlternatives {
+			break
+		}
+	}
+	return alts
+}
+
+// mentionedFirst returns the index of the restaurant whose name appears earliest in
+// content, or -1 if none is mentioned.
+func mentionedFirst(restaurants []Restaurant, content string) int {
+	pick, first := -1, -1
+	lower := strings.ToLower(content)
+	for i, r := range restaurants {
+		if idx := strings.Index(lower, strings.ToLower(r.Name)); idx >= 0 && (first < 0 || idx < first) {
+			pick, first = i, idx
+		}
+	}
+	return pick
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAlternatives(t *testing.T) {
+	content := "Go to Fancy Eats for a special night.\n\n**Alternatives:**\n- The Gourmet Spot: closer and cheaper\n- **Budget Bites** – great value\n"
+	text, alts := parseAlternatives(content)
+	if text != "Go to Fancy Eats for a special night." {
+		t.Errorf("content = %q, want the tail removed", text)
+	}
+	want := []Alternative{{Name: "The Gourmet Spot", Reason: "closer and cheaper"}, {Name: "Budget Bites", Reason: "great value"}}
+	if !reflect.DeepEqual(alts, want) {
+		t.Errorf("alternatives = %+v, want %+v", alts, want)
+	}
+}
+
+func TestParseAlternativesWithoutSection(t *testing.T) {
+	for _, content := range []string{"Go to Fancy Eats.", "Go to Fancy Eats.\nAlternatives:\nnone really"} {
+		text, alts := parseAlternatives(content)
+		if text != content || alts != nil {
+			t.Errorf("parseAlternatives(%q) = %q, %v, want the content unchanged and no alternatives", content, text, alts)
+		}
+	}
+}
+
+func TestParseAlternativesCapsCount(t *testing.T) {
+	_, alts := parseAlternatives("Pick A.\nAlternatives:\n1. B: b\n2. C: c\n3. D: d\n4. E: e")
+	if len(alts) != maxAlternatives {
+		t.Errorf("got %d alternatives, want at most %d", len(alts), maxAlternatives)
+	}
+}
+
+func TestComputeAlternatives(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "The Gourmet Spot", Rating: 4.5, Distance: 0.5, Price: 25},
+		{Name: "Fancy Eats", Rating: 4.7, Distance: 1.2, Price: 40},
+		{Name: "Budget Bites", Rating: 4.0, Distance: 0.8, Price: 15},
+	}
+	alts := computeAlternatives(restaurants, "You'll love Fancy Eats.", "")
+	want := []Alternative{
+		{Name: "The Gourmet Spot", Reason: "rated 4.5, 0.5 miles away, about $25"},
+		{Name: "Budget Bites", Reason: "rated 4.0, 0.8 miles away, about $15"},
+	}
+	if !reflect.DeepEqual(alts, want) {
+		t.Errorf("alternatives = %+v, want %+v", alts, want)
+	}
+
+	alts = computeAlternatives(restaurants, "No names here.", "")
+	if len(alts) != 2 || alts[0].Name != "Fancy Eats" || alts[1].Name != "Budget Bites" {
+		t.Errorf("without a mention the top-ranked pick should be skipped, got %+v", alts)
+	}
+	if alts := computeAlternatives(restaurants[:1], "", ""); alts != nil {
+		t.Errorf("one candidate gave alternatives %v", alts)
+	}
+}
+
+func TestAlternativesInResponse(t *testing.T) {
+	newOllamaStub(t, reply("Try Fancy Eats."))
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco", "alternatives": true}`))
+	alts, _ := resp["alternatives"].([]interface{})
+	if len(alts) != 2 {
+		t.Fatalf("alternatives = %v, want the two computed runners-up", resp["alternatives"])
+	}
+	if got := messageContent(t, resp); got != "Try Fancy Eats." {
+		t.Errorf("content = %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ollamaBackends returns the configured Ollama base URLs: the comma-separated OLLAMA_URLS
+// when set, otherwise the single OLLAMA_URL (defaulting to localhost).
+func ollamaBackends() ([]*url.URL, error) {
+	raws := []string{os.Getenv("OLLAMA_URL")}
+	if list := os.Getenv("OLLAMA_URLS"); list != "" {
+		raws = nil
+		for _, raw := range strings.Split(list, ",") {
+			if raw = strings.TrimSpace(raw); raw != "" {
+				raws = append(raws, raw)
+			}
+		}
+	}
+	backends := make([]*url.URL, 0, len(raws))
+	for _, raw := range raws {
+		u, err := parseOllamaURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, u)
+	}
+	return backends, nil
+}
+
+// backendPool round-robins requests across Ollama backends, skipping any whose recent
+// calls fail too often (see healthWindow.healthy).
+type backendPool struct {
+	next   atomic.Uint64
+	mu     sync.Mutex
+	health map[string]*healthWindow // by base URL
+}
+
+// backends balances chat calls across the configured Ollama instances.
+var backends = &backendPool{health: make(map[string]*healthWindow)}
+
+// window returns the health window for base, creating it on first use.
+func (p *backendPool) window(base *url.URL) *healthWindow {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.health[base.String()]
+	if !ok {
+		h = &healthWindow{}
+		p.health[base.String()] = h
+	}
+	return h
+}
+
+// pick returns the next healthy backend in round-robin order. If every backend is
+// unhealthy it returns the next one anyway, so a recovered backend gets traffic again.
+func (p *backendPool) pick(candidates []*url.URL) *url.URL {
+	start := int(p.next.Add(1) - 1)
+	for i := range candidates {
+		base := candidates[(start+i)%len(candidates)]
+		if len(candidates) == 1 || p.window(base).healthy() {
+			return base
+		}
+	}
+	return candidates[start%len(candidates)]
+}
+
+// record adds a call outcome for base.
+func (p *backendPool) record(base *url.URL, ok bool) {
+	p.window(base).record(ok)
+}
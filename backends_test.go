@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+// resetBackends gives the test a fresh backend pool.
+func resetBackends(t *testing.T) {
+	t.Helper()
+	old := backends
+	backends = &backendPool{health: make(map[string]*healthWindow)}
+	t.Cleanup(func() { backends = old })
+}
+
+func TestOllamaBackends(t *testing.T) {
+	t.Setenv("OLLAMA_URL", "http://one:11434")
+	got, err := ollamaBackends()
+	if err != nil || len(got) != 1 || got[0].Host != "one:11434" {
+		t.Errorf("single URL: ollamaBackends = %v, %v", got, err)
+	}
+	t.Setenv("OLLAMA_URLS", "http://a:11434, http://b:11434,")
+	got, err = ollamaBackends()
+	if err != nil || len(got) != 2 || got[0].Host != "a:11434" || got[1].Host != "b:11434" {
+		t.Errorf("OLLAMA_URLS: ollamaBackends = %v, %v", got, err)
+	}
+	t.Setenv("OLLAMA_URLS", "http://a:11434,not a url")
+	if _, err := ollamaBackends(); err == nil {
+		t.Error("ollamaBackends accepted an invalid URL")
+	}
+}
+
+func TestRequestsDistributeAcrossBackends(t *testing.T) {
+	resetBackends(t)
+	resetHealth(t)
+	a := newOllamaStub(t, reply("from a"))
+	b := newOllamaStub(t, reply("from b"))
+	t.Setenv("OLLAMA_URLS", a.URL+","+b.URL)
+
+	for i := 0; i < 6; i++ {
+		if _, err := sendChat(context.Background(), ChatRequest{Model: "llama3.2"}); err != nil {
+			t.Fatalf("sendChat: %v", err)
+		}
+	}
+	if na, nb := len(a.received()), len(b.received()); na != 3 || nb != 3 {
+		t.Errorf("backends got %d and %d requests, want 3 each", na, nb)
+	}
+}
+
+func TestUnhealthyBackendIsBypassed(t *testing.T) {
+	resetBackends(t)
+	resetHealth(t)
+	a := newOllamaStub(t, reply("from a"))
+	b := newOllamaStub(t, reply("from b"))
+	t.Setenv("OLLAMA_URLS", a.URL+","+b.URL)
+	aURL, _ := url.Parse(a.URL)
+	for i := 0; i < 5; i++ {
+		backends.record(aURL, false)
+	}
+
+	for i := 0; i < 4; i++ {
+		resp, err := sendChat(context.Background(), ChatRequest{Model: "llama3.2"})
+		if err != nil {
+			t.Fatalf("sendChat: %v", err)
+		}
+		if resp.Message.Content != "from b" {
+			t.Errorf("request %d answered %q, want the healthy backend", i, resp.Message.Content)
+		}
+	}
+	if n := len(a.received()); n != 0 {
+		t.Errorf("unhealthy backend got %d requests", n)
+	}
+}
+
+func TestPickFallsBackWhenAllUnhealthy(t *testing.T) {
+	resetBackends(t)
+	a, _ := url.Parse("http://a:11434")
+	b, _ := url.Parse("http://b:11434")
+	for i := 0; i < 5; i++ {
+		backends.record(a, false)
+		backends.record(b, false)
+	}
+	if got := backends.pick([]*url.URL{a, b}); got != a && got != b {
+		t.Errorf("pick = %v, want one of the backends anyway", got)
+	}
+}
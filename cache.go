@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached provider result.
+type cacheEntry struct {
+	restaurants []Restaurant
+	fetchedAt   time.Time
+	expiresAt   time.Time
+}
+
+// restaurantCache caches provider results keyed by provider and location, so
+// providers with different freshness needs never share entries.
+type restaurantCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newRestaurantCache() *restaurantCache {
+	return &restaurantCache{entries: make(map[string]cacheEntry)}
+}
+
+// cache is the process-wide restaurant cache.
+var cache = newRestaurantCache()
+
+// cacheKey builds a provider-scoped key for a search area.
+func cacheKey(provider string, area searchArea) string {
+	return provider + "|" + area.key()
+}
+
+// cacheTTL returns how long results from provider stay fresh: CACHE_TTL_<PROVIDER>
+// (e.g. CACHE_TTL_YELP) if set, otherwise the global CACHE_TTL, otherwise 10 minutes.
+func cacheTTL(provider string) time.Duration {
+	global := envDuration("CACHE_TTL", 10*time.Minute)
+	return envDuration("CACHE_TTL_"+strings.ToUpper(provider), global)
+}
+
+// get returns a copy of the cached restaurants for key and when they were fetched,
+// if present and not expired.
+func (c *restaurantCache) get(key string) ([]Restaurant, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if time.Now().After(e.expiresAt) {
+		delete(c.entries, key)
+		return nil, time.Time{}, false
+	}
+	return append([]Restaurant(nil), e.restaurants...), e.fetchedAt, true
+}
+
+// set stores restaurants under key for ttl.
+func (c *restaurantCache) set(key string, restaurants []Restaurant, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{
+		restaurants: append([]Restaurant(nil), restaurants...),
+		fetchedAt:   now,
+		expiresAt:   now.Add(ttl),
+	}
+}
+
+// stubProvider names the built-in sample data source returned by getRestaurants.
+const stubProvider = "stub"
+
+// fetches deduplicates concurrent provider calls for the same cache key.
+var fetches flightGroup
+
+// provider is the restaurant data source behind fetchRestaurants. Tests replace it.
+var provider = getRestaurants
+
+// fetchRestaurants returns restaurants for area from the cache, fetching
+// from the provider and caching the result with the provider's TTL on a miss.
+// It also returns when the data was fetched, which is now for a live fetch.
+// Concurrent misses for the same area share one provider call. Filters are applied
+// after fetching, so the cache key alone identifies identical lookups.
+//
+// At most MAX_FETCH (default 50) restaurants, each with at most REVIEWS_PER_RESTAURANT
+// reviews (default unlimited), are requested from the provider, and any extras from a
+// provider that ignores the limits are dropped, keeping the most recent reviews. This is
+// separate from PROMPT_REVIEWS_PER_RESTAURANT, which only limits what the model sees.
+//
+// With EMPTY_RESULT_RETRY=true, an empty (but successful) provider result is retried once
+// after EMPTY_RESULT_RETRY_DELAY (default 500ms), since providers occasionally return
+// nothing for a valid location while re-indexing. Errors are never retried here. The
+// retry counts against the request's retry budget and is skipped once that is spent.
+//
+// The whole provider exchange, retry included, is bounded by PROVIDER_TIMEOUT (default
+// 10s), independently of the Ollama call. Because the fetch is shared with concurrent
+// callers, it is not canceled when the first caller goes away, only when it times out.
+func fetchRestaurants(ctx context.Context, area searchArea) ([]Restaurant, time.Time, error) {
+	key := cacheKey(stubProvider, area)
+	if restaurants, fetchedAt, ok := cache.get(key); ok {
+		return restaurants, fetchedAt, nil
+	}
+	restaurants, err := fetches.do(key, func() ([]Restaurant, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), envDuration("PROVIDER_TIMEOUT", 10*time.Second))
+		defer cancel()
+
+		opts := fetchOptions{Limit: envInt("MAX_FETCH", 50), MaxReviews: envInt("REVIEWS_PER_RESTAURANT", 0)}
+		restaurants, err := provider(ctx, area, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(restaurants) == 0 && envBool("EMPTY_RESULT_RETRY") {
+			if done, ok := startRetry(ctx, "provider fetch"); ok {
+				delay := envDuration("EMPTY_RESULT_RETRY_DELAY", 500*time.Millisecond)
+				log.Printf("Provider returned no restaurants for %q, retrying in %s", area.Name, delay)
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					done()
+					return nil, ctx.Err()
+				}
+				restaurants, err = provider(ctx, area, opts)
+				done()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if opts.Limit > 0 && len(restaurants) > opts.Limit {
+			restaurants = restaurants[:opts.Limit]
+		}
+		if opts.MaxReviews > 0 {
+			for i := range restaurants {
+				restaurants[i].Reviews = recentReviews(restaurants[i].Reviews, opts.MaxReviews)
+			}
+		}
+		cache.set(key, restaurants, cacheTTL(stubProvider))
+		return restaurants, nil
+	})
+	return restaurants, time.Now(), err
+}
+
+// flush removes the entries for area, or all entries when area is empty, and returns
+// how many were removed.
+func (c *restaurantCache) flush(area string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for k := range c.entries {
+		if _, entryArea, _ := strings.Cut(k, "|"); area == "" || entryArea == area {
+			delete(c.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// size returns the number of entries currently cached, including any not yet pruned after expiry.
+func (c *restaurantCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
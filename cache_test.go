@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCacheTTLPerProvider(t *testing.T) {
+	if got := cacheTTL("osm"); got != 10*time.Minute {
+		t.Errorf("default TTL = %s, want 10m", got)
+	}
+	t.Setenv("CACHE_TTL", "5m")
+	t.Setenv("CACHE_TTL_YELP", "1h")
+	for provider, want := range map[string]time.Duration{"yelp": time.Hour, "osm": 5 * time.Minute} {
+		if got := cacheTTL(provider); got != want {
+			t.Errorf("cacheTTL(%q) = %s, want %s", provider, got, want)
+		}
+	}
+}
+
+func TestCacheKeysAreProviderScoped(t *testing.T) {
+	area := searchArea{Name: "San Francisco"}
+	yelpKey, osmKey := cacheKey("yelp", area), cacheKey("osm", area)
+	if yelpKey == osmKey {
+		t.Fatalf("providers share the cache key %q", yelpKey)
+	}
+
+	c := newRestaurantCache()
+	c.set(yelpKey, []Restaurant{{Name: "Budget Bites"}}, time.Minute)
+	if _, _, ok := c.get(osmKey); ok {
+		t.Error("osm lookup hit the yelp entry")
+	}
+	if got, _, ok := c.get(yelpKey); !ok || len(got) != 1 {
+		t.Errorf("yelp lookup = %v, %v, want the cached entry", got, ok)
+	}
+}
+
+func TestCacheEntriesExpire(t *testing.T) {
+	c := newRestaurantCache()
+	c.set("stub|sf", []Restaurant{{Name: "Fancy Eats"}}, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, _, ok := c.get("stub|sf"); ok {
+		t.Error("entry is still served after its TTL")
+	}
+
+	c.set("stub|sf", []Restaurant{{Name: "Fancy Eats"}}, 0)
+	if c.size() != 0 {
+		t.Error("an entry with a zero TTL was cached")
+	}
+}
+
+// setProvider makes fetchRestaurants use fetch, with an empty cache, for the rest of the test.
+func setProvider(t *testing.T, fetch func(context.Context, searchArea, fetchOptions) ([]Restaurant, error)) {
+	t.Helper()
+	old := provider
+	provider = fetch
+	cache.flush("")
+	t.Cleanup(func() {
+		provider = old
+		cache.flush("")
+	})
+}
+
+func TestMaxFetchLimitsProvider(t *testing.T) {
+	t.Setenv("MAX_FETCH", "2")
+	var asked fetchOptions
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		asked = opts
+		// Ignore the limit, as some provider APIs do.
+		return []Restaurant{{Name: "A"}, {Name: "B"}, {Name: "C"}, {Name: "D"}}, nil
+	})
+
+	restaurants, _, err := fetchRestaurants(context.Background(), searchArea{Name: "San Francisco"})
+	if err != nil {
+		t.Fatalf("fetchRestaurants: %v", err)
+	}
+	if asked.Limit != 2 {
+		t.Errorf("provider was asked for %d restaurants, want MAX_FETCH", asked.Limit)
+	}
+	if len(restaurants) != 2 {
+		t.Errorf("got %d restaurants, want extras truncated to 2", len(restaurants))
+	}
+}
+
+func TestMaxFetchDefault(t *testing.T) {
+	var asked fetchOptions
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		asked = opts
+		return nil, nil
+	})
+	fetchRestaurants(context.Background(), searchArea{Name: "San Francisco"})
+	if asked.Limit != 50 {
+		t.Errorf("provider was asked for %d restaurants, want the default 50", asked.Limit)
+	}
+
+	if got, _ := getRestaurants(context.Background(), searchArea{}, fetchOptions{Limit: 1}); len(got) != 1 {
+		t.Errorf("the stub provider returned %d restaurants for a limit of 1", len(got))
+	}
+}
+
+func TestEmptyResultIsRetriedOnce(t *testing.T) {
+	t.Setenv("EMPTY_RESULT_RETRY", "true")
+	t.Setenv("EMPTY_RESULT_RETRY_DELAY", "1ms")
+	calls := 0
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		calls++
+		if calls == 1 {
+			return nil, nil
+		}
+		return []Restaurant{{Name: "Budget Bites"}}, nil
+	})
+	got, _, err := fetchRestaurants(context.Background(), searchArea{Name: "San Francisco"})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("fetchRestaurants = %v, %v, want the retried result", got, err)
+	}
+	if calls != 2 {
+		t.Errorf("provider called %d times, want 2", calls)
+	}
+}
+
+func TestEmptyResultRetryGivesUp(t *testing.T) {
+	t.Setenv("EMPTY_RESULT_RETRY", "true")
+	t.Setenv("EMPTY_RESULT_RETRY_DELAY", "1ms")
+	calls := 0
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		calls++
+		return nil, nil
+	})
+	got, _, err := fetchRestaurants(context.Background(), searchArea{Name: "Nowhere"})
+	if err != nil || len(got) != 0 {
+		t.Fatalf("fetchRestaurants = %v, %v, want an empty result without error", got, err)
+	}
+	if calls != 2 {
+		t.Errorf("provider called %d times, want one retry", calls)
+	}
+}
+
+func TestEmptyResultRetryOffAndErrors(t *testing.T) {
+	calls := 0
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		calls++
+		return nil, nil
+	})
+	fetchRestaurants(context.Background(), searchArea{Name: "Nowhere"})
+	if calls != 1 {
+		t.Errorf("provider called %d times with EMPTY_RESULT_RETRY unset, want 1", calls)
+	}
+
+	t.Setenv("EMPTY_RESULT_RETRY", "true")
+	t.Setenv("EMPTY_RESULT_RETRY_DELAY", "1ms")
+	calls = 0
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		calls++
+		return nil, errors.New("provider down")
+	})
+	if _, _, err := fetchRestaurants(context.Background(), searchArea{Name: "Nowhere"}); err == nil {
+		t.Error("fetchRestaurants hid the provider error")
+	}
+	if calls != 1 {
+		t.Errorf("provider error was retried: %d calls", calls)
+	}
+}
+
+// slowProvider waits for its context, or a second if the timeout never fires.
+func slowProvider(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(time.Second):
+		return []Restaurant{{Name: "Too late"}}, nil
+	}
+}
+
+func TestProviderTimeoutFires(t *testing.T) {
+	t.Setenv("PROVIDER_TIMEOUT", "20ms")
+	setProvider(t, slowProvider)
+	start := time.Now()
+	_, _, err := fetchRestaurants(context.Background(), searchArea{Name: "San Francisco"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("fetchRestaurants error = %v, want a deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("timeout took %s", elapsed)
+	}
+
+	if rec := getRestaurantList(t, "location=San+Francisco"); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status %d, want 504", rec.Code)
+	}
+}
+
+func TestProviderTimeoutDegrades(t *testing.T) {
+	t.Setenv("PROVIDER_TIMEOUT", "20ms")
+	t.Setenv("PROVIDER_TIMEOUT_MODE", "degrade")
+	setProvider(t, slowProvider)
+	rec := getRestaurantList(t, "location=San+Francisco")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	warnings, _ := decodeJSON(t, rec)["warnings"].([]interface{})
+	if len(warnings) == 0 || warnings[0] != "restaurant provider timed out; results may be incomplete" {
+		t.Errorf("warnings = %v, want the timeout reported", warnings)
+	}
+}
+
+func TestReviewsPerRestaurantLimitsProvider(t *testing.T) {
+	t.Setenv("REVIEWS_PER_RESTAURANT", "2")
+	var asked fetchOptions
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		asked = opts
+		return []Restaurant{{Name: "A", Reviews: []Review{
+			{Text: "oldest", Date: day(1)}, {Text: "newest", Date: day(9)}, {Text: "middle", Date: day(5)},
+		}}}, nil
+	})
+	got, _, err := fetchRestaurants(context.Background(), searchArea{Name: "San Francisco"})
+	if err != nil {
+		t.Fatalf("fetchRestaurants: %v", err)
+	}
+	if asked.MaxReviews != 2 {
+		t.Errorf("provider asked for %d reviews, want 2", asked.MaxReviews)
+	}
+	if texts := reviewTexts(got[0].Reviews); len(texts) != 2 || texts[0] != "newest" || texts[1] != "middle" {
+		t.Errorf("kept reviews %q, want the two most recent", texts)
+	}
+}
+
+func TestDataAgeReflectsCacheEntry(t *testing.T) {
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		return []Restaurant{{Name: "Budget Bites"}}, nil
+	})
+	rec := getRestaurantList(t, "location=San+Francisco")
+	if age := decodeJSON(t, rec)["data_age_seconds"]; age != 0.0 {
+		t.Errorf("live fetch data_age_seconds = %v, want 0", age)
+	}
+
+	// Age the cached entry as if it had been fetched 90 seconds ago.
+	key := cacheKey(stubProvider, searchArea{Name: "San Francisco"})
+	cache.mu.Lock()
+	e := cache.entries[key]
+	e.fetchedAt = e.fetchedAt.Add(-90 * time.Second)
+	cache.entries[key] = e
+	cache.mu.Unlock()
+
+	rec = getRestaurantList(t, "location=San+Francisco")
+	if age, _ := decodeJSON(t, rec)["data_age_seconds"].(float64); age < 90 || age > 92 {
+		t.Errorf("cached data_age_seconds = %v, want about 90", age)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envBool reports whether the environment variable name is set to a true value ("true", "1", ...).
+func envBool(name string) bool {
+	v, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && v
+}
+
+// envDuration reads a duration such as "30s" from the environment variable name,
+// returning def when it is unset or invalid.
+func envDuration(name string, def time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Invalid %s %q, using default %s", name, raw, def)
+		return def
+	}
+	return d
+}
+
+// envInt reads an integer from the environment variable name, returning def when it is unset or invalid.
+func envInt(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Invalid %s %q, using default %d", name, raw, def)
+		return def
+	}
+	return n
+}
+
+// envFloat reads a number from the environment variable name, returning def when it is unset or invalid.
+func envFloat(name string, def float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("Invalid %s %q, using default %g", name, raw, def)
+		return def
+	}
+	return f
+}
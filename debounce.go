@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// debounceEntry remembers a recent request from one client.
+type debounceEntry struct {
+	seenAt      time.Time
+	done        bool // whether a successful response has been recorded
+	status      int
+	contentType string
+	body        []byte
+}
+
+// debouncer tracks recent identical requests per client.
+type debouncer struct {
+	mu      sync.Mutex
+	entries map[string]*debounceEntry
+}
+
+var recentRequests = &debouncer{entries: make(map[string]*debounceEntry)}
+
+// debounceMiddleware protects against clients stuck in a tight loop. When DEBOUNCE_WINDOW is set,
+// an identical request body from the same client (by user field, else IP) within the window is
+// either answered with the previous response (DEBOUNCE_MODE=replay, the default) or rejected
+// with 429 (DEBOUNCE_MODE=reject) instead of being recomputed.
+func debounceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		window := envDuration("DEBOUNCE_WINDOW", 0)
+		if window <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		key := clientID(r, body) + "|" + hex.EncodeToString(sum[:])
+		reject := os.Getenv("DEBOUNCE_MODE") == "reject"
+
+		now := time.Now()
+		recentRequests.mu.Lock()
+		recentRequests.prune(now, window)
+		prev, seen := recentRequests.entries[key]
+		if seen && reject {
+			recentRequests.mu.Unlock()
+			log.Printf("Rejecting repeated request within %s", window)
+			http.Error(w, "Duplicate request, please slow down", http.StatusTooManyRequests)
+			return
+		}
+		if seen && prev.done {
+			status, contentType, replay := prev.status, prev.contentType, prev.body
+			recentRequests.mu.Unlock()
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(status)
+			w.Write(replay)
+			return
+		}
+		entry := &debounceEntry{seenAt: now}
+		recentRequests.entries[key] = entry
+		recentRequests.mu.Unlock()
+
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= 200 && rec.status < 300 {
+			recentRequests.mu.Lock()
+			entry.done = true
+			entry.status = rec.status
+			entry.contentType = w.Header().Get("Content-Type")
+			entry.body = rec.body.Bytes()
+			recentRequests.mu.Unlock()
+		}
+	})
+}
+
+// prune drops entries older than window. The caller must hold d.mu.
+func (d *debouncer) prune(now time.Time, window time.Duration) {
+	for key, e := range d.entries {
+		if now.Sub(e.seenAt) > window {
+			delete(d.entries, key)
+		}
+	}
+}
+
+// clientID identifies the caller by the request's user field when present, else by remote IP.
+func clientID(r *http.Request, body []byte) string {
+	var fields struct {
+		User string `json:"user"`
+	}
+	if json.Unmarshal(body, &fields) == nil && fields.User != "" {
+		return "user:" + hashUser(fields.User)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// recordingWriter passes a response through while keeping a copy of its status and body.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
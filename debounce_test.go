@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// countingHandler answers with a numbered body so replays can be told from fresh responses.
+func countingHandler(calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"call": %d}`, *calls)
+	})
+}
+
+// sendDebounced sends body from the default test client through handler.
+func sendDebounced(handler http.Handler, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	return rec
+}
+
+// resetDebouncer forgets the requests earlier tests made.
+func resetDebouncer(t *testing.T) {
+	t.Helper()
+	recentRequests.mu.Lock()
+	recentRequests.entries = make(map[string]*debounceEntry)
+	recentRequests.mu.Unlock()
+}
+
+func TestDebounceReplaysIdenticalRequest(t *testing.T) {
+	resetDebouncer(t)
+	t.Setenv("DEBOUNCE_WINDOW", "1m")
+	calls := 0
+	handler := debounceMiddleware(countingHandler(&calls))
+
+	first := sendDebounced(handler, `{"location": "San Francisco"}`)
+	second := sendDebounced(handler, `{"location": "San Francisco"}`)
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Errorf("second response = %d %s, want a replay of %s", second.Code, second.Body, first.Body)
+	}
+	if ct := second.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("replay Content-Type = %q", ct)
+	}
+
+	sendDebounced(handler, `{"location": "Oakland"}`)
+	if calls != 2 {
+		t.Error("a different request was debounced")
+	}
+}
+
+func TestDebounceRejectsIdenticalRequest(t *testing.T) {
+	resetDebouncer(t)
+	t.Setenv("DEBOUNCE_WINDOW", "1m")
+	t.Setenv("DEBOUNCE_MODE", "reject")
+	calls := 0
+	handler := debounceMiddleware(countingHandler(&calls))
+
+	if rec := sendDebounced(handler, `{"location": "San Francisco"}`); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	if rec := sendDebounced(handler, `{"location": "San Francisco"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second request: status %d, want 429", rec.Code)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestDebounceSeparatesUsersBehindOneIP(t *testing.T) {
+	resetDebouncer(t)
+	t.Setenv("DEBOUNCE_WINDOW", "1m")
+	t.Setenv("DEBOUNCE_MODE", "reject")
+	calls := 0
+	handler := debounceMiddleware(countingHandler(&calls))
+
+	for _, user := range []string{"alice", "bob"} {
+		if rec := sendDebounced(handler, `{"location": "San Francisco", "user": "`+user+`"}`); rec.Code != http.StatusOK {
+			t.Errorf("user %s: status %d, want each user debounced separately", user, rec.Code)
+		}
+	}
+	if rec := sendDebounced(handler, `{"location": "San Francisco", "user": "alice"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("alice's repeat: status %d, want 429", rec.Code)
+	}
+}
+
+func TestDebounceOffByDefault(t *testing.T) {
+	resetDebouncer(t)
+	calls := 0
+	handler := debounceMiddleware(countingHandler(&calls))
+	sendDebounced(handler, `{"location": "San Francisco"}`)
+	sendDebounced(handler, `{"location": "San Francisco"}`)
+	if calls != 2 {
+		t.Errorf("handler ran %d times without DEBOUNCE_WINDOW, want 2", calls)
+	}
+}
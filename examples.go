@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// promptExample is one few-shot example: a sample prompt and the ideal reply to it.
+// Examples are defined in PROMPT_EXAMPLES as a JSON array, e.g.
+//
+//	[{"input": "User is looking for restaurants near Springfield...",
+//	  "output": "For a relaxed dinner, try Luigi's..."}]
+//
+// They are sent as prior user/assistant turns before the real prompt.
+type promptExample struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// loadExamples parses PROMPT_EXAMPLES. An unset variable yields no examples.
+func loadExamples() ([]promptExample, error) {
+	raw := os.Getenv("PROMPT_EXAMPLES")
+	if raw == "" {
+		return nil, nil
+	}
+	var examples []promptExample
+	if err := json.Unmarshal([]byte(raw), &examples); err != nil {
+		return nil, fmt.Errorf("invalid PROMPT_EXAMPLES: %w", err)
+	}
+	for i, ex := range examples {
+		if ex.Input == "" || ex.Output == "" {
+			return nil, fmt.Errorf("invalid PROMPT_EXAMPLES: example %d needs both input and output", i)
+		}
+	}
+	return examples, nil
+}
+
+// exampleMessages renders examples as alternating user and assistant messages.
+func exampleMessages(examples []promptExample) []ChatMessage {
+	messages := make([]ChatMessage, 0, 2*len(examples))
+	for _, ex := range examples {
+		messages = append(messages,
+			ChatMessage{Role: "user", Content: ex.Input},
+			ChatMessage{Role: "assistant", Content: ex.Output},
+		)
+	}
+	return messages
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLoadExamples(t *testing.T) {
+	if examples, err := loadExamples(); err != nil || examples != nil {
+		t.Errorf("unset: loadExamples = %v, %v, want none", examples, err)
+	}
+	for _, raw := range []string{`not json`, `[{"input": "only input"}]`, `{"input": "a", "output": "b"}`} {
+		t.Setenv("PROMPT_EXAMPLES", raw)
+		if _, err := loadExamples(); err == nil {
+			t.Errorf("loadExamples accepted %s", raw)
+		}
+	}
+}
+
+func TestExamplesPrecedeUserMessage(t *testing.T) {
+	t.Setenv("PROMPT_EXAMPLES", `[{"input": "Sample context", "output": "Ideal reply"}, {"input": "Second context", "output": "Second reply"}]`)
+	stub := newOllamaStub(t, reply("Try Budget Bites."))
+	if rec := postChatCompletion(t, `{"location": "San Francisco"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	messages := stub.received()[0].Messages
+	if len(messages) != 5 {
+		t.Fatalf("sent %d messages, want 4 example turns and the prompt", len(messages))
+	}
+	want := []ChatMessage{
+		{Role: "user", Content: "Sample context"},
+		{Role: "assistant", Content: "Ideal reply"},
+		{Role: "user", Content: "Second context"},
+		{Role: "assistant", Content: "Second reply"},
+	}
+	for i, m := range want {
+		if messages[i].Role != m.Role || messages[i].Content != m.Content {
+			t.Errorf("message %d = %s %q, want %s %q", i, messages[i].Role, messages[i].Content, m.Role, m.Content)
+		}
+	}
+	if last := messages[4]; last.Role != "user" || last.Content == "Sample context" {
+		t.Errorf("last message = %+v, want the real prompt", last)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filters narrows the candidate restaurants before they are shown to the model.
+// Zero values mean "no constraint".
+type Filters struct {
+	Cuisine     string   // matched case-insensitively against Restaurant.Cuisine
+	MinPrice    float64  // dollars
+	MaxPrice    float64  // dollars
+	MaxDistance float64  // miles
+	MaxWait     *int     // minutes; restaurants with an unknown wait are kept
+	Features    []string // all must be present; restaurants without feature data never match
+}
+
+// filtersFromRequest collects the filters requested explicitly in reqData.
+func filtersFromRequest(reqData RequestBody) Filters {
+	return Filters{
+		Cuisine:  strings.ToLower(strings.TrimSpace(reqData.Cuisine)),
+		MinPrice: reqData.MinPrice,
+		MaxPrice: reqData.MaxPrice,
+		MaxWait:  reqData.MaxWait,
+		Features: reqData.Features,
+	}
+}
+
+// merge fills any constraint f leaves unset from other, so explicit request
+// fields take precedence over filters inferred from the query text.
+func (f Filters) merge(other Filters) Filters {
+	if f.Cuisine == "" {
+		f.Cuisine = other.Cuisine
+	}
+	if f.MinPrice == 0 {
+		f.MinPrice = other.MinPrice
+	}
+	if f.MaxPrice == 0 {
+		f.MaxPrice = other.MaxPrice
+	}
+	if f.MaxDistance == 0 {
+		f.MaxDistance = other.MaxDistance
+	}
+	if f.MaxWait == nil {
+		f.MaxWait = other.MaxWait
+	}
+	if len(f.Features) == 0 {
+		f.Features = other.Features
+	}
+	return f
+}
+
+// applied summarizes the constraints f actually sets, keyed like the request fields,
+// for the applied_filters response field.
+func (f Filters) applied() map[string]interface{} {
+	applied := make(map[string]interface{})
+	if f.Cuisine != "" {
+		applied["cuisine"] = f.Cuisine
+	}
+	if f.MinPrice > 0 {
+		applied["min_price"] = f.MinPrice
+	}
+	if f.MaxPrice > 0 {
+		applied["max_price"] = f.MaxPrice
+	}
+	if f.MaxDistance > 0 {
+		applied["max_distance"] = f.MaxDistance
+	}
+	if f.MaxWait != nil {
+		applied["max_wait"] = *f.MaxWait
+	}
+	if len(f.Features) > 0 {
+		applied["features"] = f.Features
+	}
+	return applied
+}
+
+// filterRestaurants returns the restaurants that satisfy f, preserving order.
+func filterRestaurants(restaurants []Restaurant, f Filters) []Restaurant {
+	var kept []Restaurant
+	for _, r := range restaurants {
+		if f.Cuisine != "" && !strings.EqualFold(r.Cuisine, f.Cuisine) {
+			continue
+		}
+		if f.MinPrice > 0 && r.Price < f.MinPrice {
+			continue
+		}
+		if f.MaxPrice > 0 && r.Price > f.MaxPrice {
+			continue
+		}
+		if f.MaxDistance > 0 && r.Distance > f.MaxDistance {
+			continue
+		}
+		if f.MaxWait != nil && r.WaitMinutes != nil && *r.WaitMinutes > *f.MaxWait {
+			continue
+		}
+		if !hasAllFeatures(r, f.Features) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// pinRestaurants moves the restaurants of all named in pins (case-insensitively) to the
+// front of kept, marked as pinned, adding any that the filters dropped and marking those
+// unmatched. Pins that match nothing are ignored.
+func pinRestaurants(all, kept []Restaurant, pins []string) []Restaurant {
+	if len(pins) == 0 {
+		return kept
+	}
+	isPinned := func(r Restaurant) bool {
+		for _, name := range pins {
+			if strings.EqualFold(strings.TrimSpace(name), r.Name) {
+				return true
+			}
+		}
+		return false
+	}
+	var pinned, rest []Restaurant
+	matched := make(map[string]bool)
+	for _, r := range kept {
+		if isPinned(r) {
+			matched[r.Name] = true
+			continue
+		}
+		rest = append(rest, r)
+	}
+	for _, r := range all {
+		if isPinned(r) {
+			r.Pinned = true
+			r.Unmatched = !matched[r.Name]
+			pinned = append(pinned, r)
+		}
+	}
+	return append(pinned, rest...)
+}
+
+// filterMatches returns restaurants without the pinned places that failed the filters.
+func filterMatches(restaurants []Restaurant) []Restaurant {
+	var matches []Restaurant
+	for _, r := range restaurants {
+		if !r.Unmatched {
+			matches = append(matches, r)
+		}
+	}
+	return matches
+}
+
+// hasAllFeatures reports whether r offers every feature in want (case-insensitively).
+func hasAllFeatures(r Restaurant, want []string) bool {
+	for _, feature := range want {
+		found := false
+		for _, have := range r.Features {
+			if strings.EqualFold(have, feature) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// knownCuisines lists the cuisine keywords parseQuery recognizes.
+var knownCuisines = []string{
+	"american", "chinese", "french", "greek", "indian", "italian", "japanese",
+	"korean", "mediterranean", "mexican", "spanish", "thai", "vietnamese",
+}
+
+// cheapMaxPrice is the price ceiling implied by words like "cheap".
+const cheapMaxPrice = 20.0
+
+var (
+	cheapPattern    = regexp.MustCompile(`(?i)\b(cheap|budget|inexpensive|affordable)\b`)
+	distancePattern = regexp.MustCompile(`(?i)\b(?:within|under|less than)\s+(an?\s+half|half|a|one|\d+(?:\.\d+)?)\s*(?:an?\s+)?(?:miles?|mi)\b`)
+	spacePattern    = regexp.MustCompile(`\s+`)
+)
+
+// parseQuery extracts structured filters from a free-text query, e.g.
+// "cheap italian within a mile" yields Cuisine "italian", MaxPrice 20 and
+// MaxDistance 1. It returns the filters and the remaining free text.
+func parseQuery(q string) (Filters, string) {
+	var f Filters
+	residual := q
+
+	if m := distancePattern.FindStringSubmatch(residual); m != nil {
+		switch amount := strings.ToLower(m[1]); {
+		case amount == "a" || amount == "one":
+			f.MaxDistance = 1
+		case strings.HasSuffix(amount, "half"):
+			f.MaxDistance = 0.5
+		default:
+			f.MaxDistance, _ = strconv.ParseFloat(amount, 64)
+		}
+		residual = strings.Replace(residual, m[0], " ", 1)
+	}
+
+	if cheapPattern.MatchString(residual) {
+		f.MaxPrice = cheapMaxPrice
+		residual = cheapPattern.ReplaceAllString(residual, " ")
+	}
+
+	for _, cuisine := range knownCuisines {
+		pattern := regexp.MustCompile(`(?i)\b` + cuisine + `\b`)
+		if pattern.MatchString(residual) {
+			f.Cuisine = cuisine
+			residual = pattern.ReplaceAllString(residual, " ")
+			break
+		}
+	}
+
+	residual = strings.TrimSpace(spacePattern.ReplaceAllString(residual, " "))
+	return f, residual
+}
+
+// priceIntents maps phrases that imply a price range to the filter they suggest.
+// The list is deliberately short: only unambiguous intents nudge the price, and
+// only when the request sets no explicit budget (see inferPriceIntent).
+var priceIntents = []struct {
+	pattern *regexp.Regexp
+	filters Filters
+}{
+	// Upscale occasions: skip the cheapest places.
+	{regexp.MustCompile(`(?i)\b(romantic|special occasion|anniversary|date night|upscale|fine dining)\b`), Filters{MinPrice: 30}},
+	// A quick bite: skip expensive sit-down places.
+	{regexp.MustCompile(`(?i)\b(quick bite|grab a bite|on the go|quick lunch)\b`), Filters{MaxPrice: 25}},
+}
+
+// inferPriceIntent returns the price filter implied by the query's intent, such as a
+// higher minimum price for "romantic dinner". It returns zero Filters if no intent matches.
+// Callers should apply it only when no explicit price bounds were given.
+func inferPriceIntent(q string) Filters {
+	for _, intent := range priceIntents {
+		if intent.pattern.MatchString(q) {
+			return intent.filters
+		}
+	}
+	return Filters{}
+}
+
+// effectiveQuery combines the operator's DEFAULT_QUERY (e.g. "vegan" for a themed
+// deployment) with the user's query. DEFAULT_QUERY_POSITION selects whether the default
+// is prepended (the default) or appended. The default applies even when the user sends no query.
+func effectiveQuery(userQuery string) string {
+	base := strings.TrimSpace(os.Getenv("DEFAULT_QUERY"))
+	userQuery = strings.TrimSpace(userQuery)
+	switch {
+	case base == "":
+		return userQuery
+	case userQuery == "":
+		return base
+	case os.Getenv("DEFAULT_QUERY_POSITION") == "append":
+		return userQuery + " " + base
+	default:
+		return base + " " + userQuery
+	}
+}
+
+// intPtr returns a pointer to n, for populating optional fields.
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// names returns the names of restaurants, in order.
+func names(restaurants []Restaurant) []string {
+	out := make([]string, 0, len(restaurants))
+	for _, r := range restaurants {
+		out = append(out, r.Name)
+	}
+	return out
+}
+
+func TestFilterMaxWait(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "Quiet", WaitMinutes: intPtr(5)},
+		{Name: "Busy", WaitMinutes: intPtr(45)},
+		{Name: "Unknown"},
+		{Name: "Exact", WaitMinutes: intPtr(15)},
+	}
+	got := names(filterRestaurants(restaurants, Filters{MaxWait: intPtr(15)}))
+	if want := []string{"Quiet", "Unknown", "Exact"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+	if got := filterRestaurants(restaurants, Filters{}); len(got) != len(restaurants) {
+		t.Errorf("no max_wait kept %d of %d restaurants", len(got), len(restaurants))
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		want     Filters
+		residual string
+	}{
+		{"cheap italian within a mile", Filters{Cuisine: "italian", MaxPrice: cheapMaxPrice, MaxDistance: 1}, ""},
+		{"French with a view", Filters{Cuisine: "french"}, "with a view"},
+		{"somewhere quiet under 2.5 miles", Filters{MaxDistance: 2.5}, "somewhere quiet"},
+		{"affordable sushi within half a mile", Filters{MaxPrice: cheapMaxPrice, MaxDistance: 0.5}, "sushi"},
+		{"good for groups", Filters{}, "good for groups"},
+		{"", Filters{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, residual := parseQuery(tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filters = %+v, want %+v", got, tt.want)
+			}
+			if residual != tt.residual {
+				t.Errorf("residual = %q, want %q", residual, tt.residual)
+			}
+		})
+	}
+}
+
+func TestRequestFiltersOverrideParsedOnes(t *testing.T) {
+	parsed, _ := parseQuery("cheap italian within a mile")
+	f := filtersFromRequest(RequestBody{Cuisine: "French", MaxPrice: 50}).merge(parsed)
+	if f.Cuisine != "french" || f.MaxPrice != 50 || f.MaxDistance != 1 {
+		t.Errorf("merged filters = %+v, want the request's cuisine and price with the parsed distance", f)
+	}
+}
+
+func TestFilterFeatures(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "Patio", Features: []string{"outdoor_seating", "accepts_cards"}},
+		{Name: "Courier", Features: []string{"delivery", "accepts_cards"}},
+		{Name: "Mystery"},
+	}
+	tests := []struct {
+		features []string
+		want     []string
+	}{
+		{[]string{"accepts_cards"}, []string{"Patio", "Courier"}},
+		{[]string{"Outdoor_Seating"}, []string{"Patio"}},
+		{[]string{"accepts_cards", "delivery"}, []string{"Courier"}},
+		{[]string{"delivery", "outdoor_seating"}, []string{}},
+		{nil, []string{"Patio", "Courier", "Mystery"}},
+	}
+	for _, tt := range tests {
+		got := names(filterRestaurants(restaurants, Filters{Features: tt.features}))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("features %v kept %v, want %v", tt.features, got, tt.want)
+		}
+	}
+}
+
+func TestInferPriceIntent(t *testing.T) {
+	tests := map[string]Filters{
+		"romantic dinner":               {MinPrice: 30},
+		"somewhere for our Anniversary": {MinPrice: 30},
+		"a quick bite near work":        {MaxPrice: 25},
+		"pizza":                         {},
+	}
+	for query, want := range tests {
+		if got := inferPriceIntent(query); !reflect.DeepEqual(got, want) {
+			t.Errorf("inferPriceIntent(%q) = %+v, want %+v", query, got, want)
+		}
+	}
+}
+
+func TestPriceIntentYieldsToExplicitBudget(t *testing.T) {
+	found, err := findCandidates(context.Background(), RequestBody{Location: "San Francisco", Query: "romantic dinner"})
+	if err != nil {
+		t.Fatalf("findCandidates: %v", err)
+	}
+	if got := names(found.Restaurants); !reflect.DeepEqual(got, []string{"Fancy Eats"}) {
+		t.Errorf("romantic dinner kept %v, want only the upscale place", got)
+	}
+
+	found, err = findCandidates(context.Background(), RequestBody{Location: "San Francisco", Query: "romantic dinner", MaxPrice: 30})
+	if err != nil {
+		t.Fatalf("findCandidates: %v", err)
+	}
+	if found.Filters.MinPrice != 0 {
+		t.Errorf("min_price %v was inferred despite an explicit max_price", found.Filters.MinPrice)
+	}
+	if got := names(found.Restaurants); len(got) != 2 {
+		t.Errorf("explicit max_price 30 kept %v, want the two places within it", got)
+	}
+}
+
+func TestEffectiveQuery(t *testing.T) {
+	tests := []struct {
+		base, position, user, want string
+	}{
+		{"", "", "with a view", "with a view"},
+		{"vegan", "", "with a view", "vegan with a view"},
+		{"vegan", "prepend", "with a view", "vegan with a view"},
+		{"vegan", "append", "with a view", "with a view vegan"},
+		{"vegan", "", "", "vegan"},
+		{" vegan ", "append", "  ", "vegan"},
+	}
+	for _, tt := range tests {
+		t.Setenv("DEFAULT_QUERY", tt.base)
+		t.Setenv("DEFAULT_QUERY_POSITION", tt.position)
+		if got := effectiveQuery(tt.user); got != tt.want {
+			t.Errorf("DEFAULT_QUERY %q (%s) with %q = %q, want %q", tt.base, tt.position, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultQueryInfersFilters(t *testing.T) {
+	t.Setenv("DEFAULT_QUERY", "italian")
+	found, err := findCandidates(context.Background(), RequestBody{Location: "San Francisco"})
+	if err != nil {
+		t.Fatalf("findCandidates: %v", err)
+	}
+	if found.Filters.Cuisine != "italian" {
+		t.Errorf("cuisine = %q, want it inferred from DEFAULT_QUERY alone", found.Filters.Cuisine)
+	}
+	if got := names(found.Restaurants); !reflect.DeepEqual(got, []string{"Budget Bites"}) {
+		t.Errorf("kept %v, want only the italian place", got)
+	}
+}
+
+func TestAppliedFiltersIncludeDefaults(t *testing.T) {
+	t.Setenv("DEFAULT_QUERY", "within 2 miles")
+	t.Setenv("DEFAULT_SORT", "rating")
+	newOllamaStub(t, reply("Try The Gourmet Spot."))
+	rec := postChatCompletion(t, `{"location": "San Francisco", "max_price": 30}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := map[string]interface{}{"max_price": 30.0, "max_distance": 2.0, "sort": "rating"}
+	if got := decodeJSON(t, rec)["applied_filters"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("applied_filters = %v, want %v", got, want)
+	}
+
+	found, err := findCandidates(context.Background(), RequestBody{Location: "San Francisco", Cuisine: "french", Query: "cheap"})
+	if err != nil {
+		t.Fatalf("findCandidates: %v", err)
+	}
+	applied := found.appliedFilters()
+	if applied["cuisine"] != "french" || applied["max_price"] != cheapMaxPrice || applied["max_distance"] != 2.0 {
+		t.Errorf("applied filters = %v, want the cuisine, the inferred price and the default distance", applied)
+	}
+}
+
+func TestPinnedPlacesSurviveFilters(t *testing.T) {
+	found, err := findCandidates(context.Background(), RequestBody{Location: "San Francisco", Cuisine: "italian", Pin: []string{" FANCY eats", "Nowhere Diner"}})
+	if err != nil {
+		t.Fatalf("findCandidates: %v", err)
+	}
+	if got := names(found.Restaurants); !reflect.DeepEqual(got, []string{"Fancy Eats", "Budget Bites"}) {
+		t.Fatalf("candidates = %v, want the pinned place first, then the match", got)
+	}
+	if pinned := found.Restaurants[0]; !pinned.Pinned || !pinned.Unmatched {
+		t.Errorf("pinned place = %+v, want it marked pinned and unmatched", pinned)
+	}
+	if found.Restaurants[1].Pinned {
+		t.Error("unpinned place marked pinned")
+	}
+
+	stub := newOllamaStub(t, reply("Try Budget Bites."))
+	postChatCompletion(t, `{"location": "San Francisco", "cuisine": "italian", "pin": ["fancy eats"]}`)
+	if prompt := stub.received()[0].Messages[0].Content; !strings.Contains(prompt, "Fancy Eats at") || !strings.Contains(prompt, "Pinned by the user") {
+		t.Errorf("prompt lacks the pinned place:\n%s", prompt)
+	}
+}
+
+func TestPinnedPlacesSurviveTokenBudget(t *testing.T) {
+	found, err := findCandidates(context.Background(), RequestBody{Location: "San Francisco", Sort: "rating", Pin: []string{"Budget Bites"}})
+	if err != nil {
+		t.Fatalf("findCandidates: %v", err)
+	}
+	if got := names(found.Restaurants); !reflect.DeepEqual(got, []string{"Budget Bites", "Fancy Eats", "The Gourmet Spot"}) {
+		t.Fatalf("candidates = %v, want the lowest-rated place first once pinned", got)
+	}
+	in := promptInput{Restaurants: found.Restaurants}
+	budget := estimateTokens(restaurantLine(found.Restaurants[0], in))
+	if got := names(fitTokenBudget(in, budget, 0)); !reflect.DeepEqual(got, []string{"Budget Bites"}) {
+		t.Errorf("budgeted candidates = %v, want the pinned place kept", got)
+	}
+
+	rec := getRestaurantList(t, "location=San+Francisco&cuisine=american&pin=Fancy%20Eats,budget%20bites")
+	var listed []string
+	for _, r := range listedRestaurants(t, rec) {
+		listed = append(listed, r["name"].(string))
+	}
+	if !reflect.DeepEqual(listed, []string{"Budget Bites", "Fancy Eats", "The Gourmet Spot"}) {
+		t.Errorf("listed = %v, want both comma-separated pins ahead of the match", listed)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// generateRequest is the payload for Ollama's /api/generate endpoint, which predates /api/chat.
+type generateRequest struct {
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt"`
+	System    string                 `json:"system,omitempty"`
+	Images    []string               `json:"images,omitempty"`
+	Stream    bool                   `json:"stream"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	Format    json.RawMessage        `json:"format,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+}
+
+// generateResponse is the reply from /api/generate.
+type generateResponse struct {
+	Model     string `json:"model"`
+	CreatedAt string `json:"created_at"`
+	Response  string `json:"response"`
+	Done      bool   `json:"done"`
+	Error     string `json:"error,omitempty"`
+}
+
+// chatlessBackends records the Ollama base URLs found to lack /api/chat, so the downgrade
+// is detected and logged once per backend rather than on every request.
+var chatlessBackends sync.Map // base URL string -> struct{}
+
+// chatUnsupported reports whether base is known to lack /api/chat.
+func chatUnsupported(base *url.URL) bool {
+	_, ok := chatlessBackends.Load(base.String())
+	return ok
+}
+
+// markChatUnsupported records that base lacks /api/chat, logging the first time.
+func markChatUnsupported(base *url.URL) {
+	if _, loaded := chatlessBackends.LoadOrStore(base.String(), struct{}{}); !loaded {
+		log.Printf("Ollama at %s has no /api/chat (older version?), falling back to /api/generate", base.Redacted())
+	}
+}
+
+// toGenerateRequest maps chatReq onto /api/generate: system messages become the system
+// prompt, a lone user message becomes the prompt, and a longer conversation (e.g. with
+// few-shot examples) is rendered as a transcript. Tools have no equivalent and are dropped.
+func toGenerateRequest(chatReq ChatRequest) generateRequest {
+	genReq := generateRequest{
+		Model:     chatReq.Model,
+		Stream:    false,
+		Options:   chatReq.Options,
+		Format:    chatReq.Format,
+		KeepAlive: chatReq.KeepAlive,
+	}
+	var system []string
+	var turns []ChatMessage
+	for _, m := range chatReq.Messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		turns = append(turns, m)
+	}
+	genReq.System = strings.Join(system, "\n\n")
+	if len(turns) == 1 {
+		genReq.Prompt = turns[0].Content
+	} else {
+		var b strings.Builder
+		for _, m := range turns {
+			fmt.Fprintf(&b, "%s: %s\n\n", roleLabel(m.Role), m.Content)
+		}
+		b.WriteString("Assistant:")
+		genReq.Prompt = b.String()
+	}
+	if len(turns) > 0 {
+		genReq.Images = turns[len(turns)-1].Images
+	}
+	if len(chatReq.Tools) > 0 {
+		log.Printf("Ignoring tools: /api/generate does not support them")
+	}
+	return genReq
+}
+
+// roleLabel names a chat role in a rendered transcript.
+func roleLabel(role string) string {
+	if role == "assistant" {
+		return "Assistant"
+	}
+	return "User"
+}
+
+// postGenerate serves chatReq through the /api/generate endpoint of the Ollama instance at
+// base, returning the reply in the shape postChat does.
+func postGenerate(ctx context.Context, base *url.URL, chatReq ChatRequest) (*ChatResponse, error) {
+	status, contentType, body, err := postOllama(ctx, base.JoinPath("/api/generate").String(), toGenerateRequest(chatReq))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOllamaBody(status, contentType, body); err != nil {
+		return nil, err
+	}
+
+	var genResp generateResponse
+	if err := json.Unmarshal(body, &genResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Ollama response (status %d): %w", status, err)
+	}
+	if status != http.StatusOK || genResp.Error != "" {
+		return nil, &ollamaError{StatusCode: status, Message: genResp.Error}
+	}
+
+	chatResp := &ChatResponse{Model: genResp.Model, CreatedAt: genResp.CreatedAt, Done: genResp.Done, Raw: body}
+	chatResp.Message.Role = "assistant"
+	chatResp.Message.Content = genResp.Response
+	return chatResp, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newLegacyOllama starts an Ollama stub without /api/chat and points OLLAMA_URL at it. It
+// returns how often /api/chat was tried and the generate requests served so far.
+func newLegacyOllama(t *testing.T) (chatHits func() int, generated func() []generateRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var hits int
+	var requests []generateRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			requests = append(requests, req)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(generateResponse{Model: req.Model, Response: "Try Fancy Eats.", Done: true})
+		case "/api/chat":
+			hits++
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_URL", srv.URL)
+	chatHits = func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits
+	}
+	generated = func() []generateRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]generateRequest(nil), requests...)
+	}
+	return chatHits, generated
+}
+
+func TestChatFallsBackToGenerate(t *testing.T) {
+	chatHits, generated := newLegacyOllama(t)
+	logs := captureLogs(t)
+	chatReq := ChatRequest{Model: "llama2", Messages: []ChatMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Where should I eat?"},
+	}}
+	for i := 0; i < 2; i++ {
+		chatResp, _, err := callOllama(context.Background(), chatReq)
+		if err != nil {
+			t.Fatalf("callOllama: %v", err)
+		}
+		if chatResp.Message.Role != "assistant" || chatResp.Message.Content != "Try Fancy Eats." {
+			t.Errorf("message = %+v, want the generate reply", chatResp.Message)
+		}
+	}
+	if n := chatHits(); n != 1 {
+		t.Errorf("/api/chat hit %d times, want only the first call", n)
+	}
+	reqs := generated()
+	if len(reqs) != 2 || reqs[0].System != "Be brief." || reqs[0].Prompt != "Where should I eat?" || reqs[0].Stream {
+		t.Errorf("generate requests = %+v", reqs)
+	}
+	if n := strings.Count(logs.String(), "falling back to /api/generate"); n != 1 {
+		t.Errorf("downgrade logged %d times, want once", n)
+	}
+}
+
+func TestGenerateFallbackCanBeDisabled(t *testing.T) {
+	t.Setenv("OLLAMA_GENERATE_FALLBACK", "false")
+	_, generated := newLegacyOllama(t)
+	if _, _, err := callOllama(context.Background(), ChatRequest{Model: "llama2"}); err == nil {
+		t.Error("callOllama succeeded against a server without /api/chat")
+	}
+	if n := len(generated()); n != 0 {
+		t.Errorf("/api/generate used %d times with the fallback off", n)
+	}
+}
+
+func TestToGenerateRequestRendersConversation(t *testing.T) {
+	genReq := toGenerateRequest(ChatRequest{Model: "llama2", Messages: []ChatMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Example?"},
+		{Role: "assistant", Content: "Example reply."},
+		{Role: "user", Content: "Real prompt", Images: []string{"aW1n"}},
+	}})
+	want := "User: Example?\n\nAssistant: Example reply.\n\nUser: Real prompt\n\nAssistant:"
+	if genReq.Prompt != want || genReq.System != "Be brief." {
+		t.Errorf("generate request = %+v, want the transcript %q", genReq, want)
+	}
+	if len(genReq.Images) != 1 || genReq.Images[0] != "aW1n" {
+		t.Errorf("images = %v, want the last turn's", genReq.Images)
+	}
+}
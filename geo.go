@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// coordinates is a WGS84 latitude/longitude pair.
+type coordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (c coordinates) String() string {
+	return fmt.Sprintf("%.5f, %.5f", c.Lat, c.Lon)
+}
+
+// searchArea describes where to look for restaurants.
+type searchArea struct {
+	Name   string       // human-readable place name used in the prompt
+	Center *coordinates // search center, when known
+}
+
+// key identifies the area for caching. Coordinates win over the name because the
+// reverse-geocoded name may change while the coordinates don't.
+func (a searchArea) key() string {
+	if a.Center != nil {
+		return fmt.Sprintf("%.4f,%.4f", a.Center.Lat, a.Center.Lon)
+	}
+	return strings.ToLower(strings.TrimSpace(a.Name))
+}
+
+// geocodingEnabled reports whether a geocoder is available. ENABLE_GEOCODING=false runs the
+// service without one: coordinates are not reverse-geocoded and distances are unknown.
+func geocodingEnabled() bool {
+	return os.Getenv("ENABLE_GEOCODING") != "false"
+}
+
+// resolveSearchArea determines the search area for a request. Coordinates, when given,
+// are used directly as the search center (and preferred over the location string),
+// and are reverse-geocoded to a display name for the prompt.
+func resolveSearchArea(ctx context.Context, reqData RequestBody) (searchArea, error) {
+	if reqData.Lat == nil && reqData.Lon == nil {
+		return searchArea{Name: reqData.Location}, nil
+	}
+	if reqData.Lat == nil || reqData.Lon == nil {
+		return searchArea{}, errors.New("lat and lon must be provided together")
+	}
+	c := coordinates{Lat: *reqData.Lat, Lon: *reqData.Lon}
+	if c.Lat < -90 || c.Lat > 90 || c.Lon < -180 || c.Lon > 180 {
+		return searchArea{}, fmt.Errorf("coordinates %s are out of range", c)
+	}
+
+	if !geocodingEnabled() {
+		return searchArea{Name: c.String(), Center: &c}, nil
+	}
+	name, err := reverseGeocode(ctx, c)
+	if err != nil {
+		log.Printf("Reverse geocoding %s failed: %v", c, err)
+		name = c.String()
+	}
+	return searchArea{Name: name, Center: &c}, nil
+}
+
+// resolveOrigin returns the origin_lat/origin_lon distances should be measured from, or nil
+// when the request gives none and distances stay relative to the search center.
+func resolveOrigin(reqData RequestBody) (*coordinates, error) {
+	if reqData.OriginLat == nil && reqData.OriginLon == nil {
+		return nil, nil
+	}
+	if reqData.OriginLat == nil || reqData.OriginLon == nil {
+		return nil, errors.New("origin_lat and origin_lon must be provided together")
+	}
+	c := coordinates{Lat: *reqData.OriginLat, Lon: *reqData.OriginLon}
+	if c.Lat < -90 || c.Lat > 90 || c.Lon < -180 || c.Lon > 180 {
+		return nil, fmt.Errorf("origin %s is out of range", c)
+	}
+	return &c, nil
+}
+
+// earthRadiusMiles is the mean radius of the Earth.
+const earthRadiusMiles = 3958.8
+
+// haversineMiles returns the great-circle distance between a and b in miles.
+func haversineMiles(a, b coordinates) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(b.Lat - a.Lat)
+	dLon := toRad(b.Lon - a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(a.Lat))*math.Cos(toRad(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMiles * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// measureFrom sets each restaurant's Distance to its distance from origin. Restaurants
+// without coordinates keep the provider's distance.
+func measureFrom(restaurants []Restaurant, origin coordinates) {
+	for i, r := range restaurants {
+		if r.Lat == 0 && r.Lon == 0 {
+			continue
+		}
+		restaurants[i].Distance = haversineMiles(origin, coordinates{Lat: r.Lat, Lon: r.Lon})
+	}
+}
+
+// reverseGeocode looks up a display name for c using a Nominatim-compatible
+// endpoint (GEOCODER_URL, defaulting to the public OpenStreetMap instance).
+func reverseGeocode(ctx context.Context, c coordinates) (string, error) {
+	base := os.Getenv("GEOCODER_URL")
+	if base == "" {
+		base = "https://nominatim.openstreetmap.org"
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid GEOCODER_URL %q: %w", base, err)
+	}
+	u = u.JoinPath("/reverse")
+	u.RawQuery = url.Values{
+		"format": {"jsonv2"},
+		"lat":    {fmt.Sprint(c.Lat)},
+		"lon":    {fmt.Sprint(c.Lon)},
+	}.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, envDuration("GEOCODER_TIMEOUT", 3*time.Second))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	// Nominatim's usage policy requires an identifying User-Agent.
+	req.Header.Set("User-Agent", "restaurant-guide")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geocoder returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode geocoder response: %w", err)
+	}
+	if result.DisplayName == "" {
+		return "", errors.New("geocoder returned no name")
+	}
+	return result.DisplayName, nil
+}
+
+// kmPerMile converts miles, the canonical unit for Restaurant.Distance, to kilometers.
+const kmPerMile = 1.609344
+
+// milesToKm converts a distance in miles to kilometers.
+func milesToKm(miles float64) float64 {
+	return miles * kmPerMile
+}
+
+// validUnits reports whether units is a supported distance unit ("" means miles).
+func validUnits(units string) bool {
+	return units == "" || units == "mi" || units == "km"
+}
+
+// formatDistance renders a distance stored in miles in the requested units, e.g. "0.8 miles" or "1.3 km".
+func formatDistance(miles float64, units string) string {
+	if units == "km" {
+		return fmt.Sprintf("%.1f km", milesToKm(miles))
+	}
+	return fmt.Sprintf("%.1f miles", miles)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newGeocoderStub starts a fake Nominatim answering every reverse lookup with name and
+// points GEOCODER_URL at it. The returned counter tracks the lookups made.
+func newGeocoderStub(t *testing.T, name string) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/reverse" || r.URL.Query().Get("lat") == "" || r.URL.Query().Get("lon") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"display_name": name})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("GEOCODER_URL", srv.URL)
+	return &calls
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestResolveSearchAreaFromCoordinates(t *testing.T) {
+	calls := newGeocoderStub(t, "Financial District, San Francisco")
+
+	area, err := resolveSearchArea(context.Background(), RequestBody{Lat: floatPtr(37.79), Lon: floatPtr(-122.4)})
+	if err != nil {
+		t.Fatalf("resolveSearchArea: %v", err)
+	}
+	if area.Name != "Financial District, San Francisco" {
+		t.Errorf("name = %q, want the reverse-geocoded one", area.Name)
+	}
+	if area.Center == nil || area.Center.Lat != 37.79 || area.Center.Lon != -122.4 {
+		t.Errorf("center = %v, want the given coordinates", area.Center)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("geocoder called %d times, want 1", calls.Load())
+	}
+}
+
+func TestResolveSearchAreaFromLocation(t *testing.T) {
+	calls := newGeocoderStub(t, "unused")
+
+	area, err := resolveSearchArea(context.Background(), RequestBody{Location: "San Francisco, CA"})
+	if err != nil {
+		t.Fatalf("resolveSearchArea: %v", err)
+	}
+	if area.Name != "San Francisco, CA" || area.Center != nil {
+		t.Errorf("area = %+v, want the location name without a center", area)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("geocoder called %d times for a place name", calls.Load())
+	}
+}
+
+func TestResolveSearchAreaPrefersCoordinates(t *testing.T) {
+	newGeocoderStub(t, "Mission District, San Francisco")
+
+	area, err := resolveSearchArea(context.Background(), RequestBody{Location: "Oakland", Lat: floatPtr(37.76), Lon: floatPtr(-122.42)})
+	if err != nil {
+		t.Fatalf("resolveSearchArea: %v", err)
+	}
+	if area.Name != "Mission District, San Francisco" || area.Center == nil {
+		t.Errorf("area = %+v, want the coordinates to win", area)
+	}
+	if area.key() != "37.7600,-122.4200" {
+		t.Errorf("cache key = %q, want it built from the coordinates", area.key())
+	}
+}
+
+func TestResolveSearchAreaFallsBackToCoordinatesAsName(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	t.Setenv("GEOCODER_URL", srv.URL)
+
+	area, err := resolveSearchArea(context.Background(), RequestBody{Lat: floatPtr(37.79), Lon: floatPtr(-122.4)})
+	if err != nil {
+		t.Fatalf("resolveSearchArea: %v", err)
+	}
+	if area.Name != "37.79000, -122.40000" {
+		t.Errorf("name = %q, want the coordinates", area.Name)
+	}
+}
+
+func TestResolveSearchAreaRejectsBadCoordinates(t *testing.T) {
+	for _, reqData := range []RequestBody{
+		{Lat: floatPtr(37.79)},
+		{Lon: floatPtr(-122.4)},
+		{Lat: floatPtr(91), Lon: floatPtr(0)},
+		{Lat: floatPtr(0), Lon: floatPtr(-181)},
+	} {
+		if _, err := resolveSearchArea(context.Background(), reqData); err == nil {
+			t.Errorf("resolveSearchArea(lat %v, lon %v) succeeded, want an error", reqData.Lat, reqData.Lon)
+		}
+	}
+}
+
+func TestDistanceConversion(t *testing.T) {
+	if got := milesToKm(1); math.Abs(got-1.609344) > 1e-9 {
+		t.Errorf("milesToKm(1) = %v, want 1.609344", got)
+	}
+	if got := formatDistance(0.8, "km"); got != "1.3 km" {
+		t.Errorf("formatDistance km = %q, want 1.3 km", got)
+	}
+	for _, units := range []string{"", "mi"} {
+		if got := formatDistance(0.8, units); got != "0.8 miles" {
+			t.Errorf("formatDistance %q = %q, want 0.8 miles", units, got)
+		}
+	}
+	for units, want := range map[string]bool{"": true, "mi": true, "km": true, "yd": false, "KM": false} {
+		if validUnits(units) != want {
+			t.Errorf("validUnits(%q) = %v, want %v", units, !want, want)
+		}
+	}
+}
+
+func TestGeocodingDisabled(t *testing.T) {
+	t.Setenv("ENABLE_GEOCODING", "false")
+	calls := newGeocoderStub(t, "unused")
+
+	found, err := findCandidates(context.Background(), RequestBody{Lat: floatPtr(37.79), Lon: floatPtr(-122.4), Query: "within half a mile"})
+	if err != nil {
+		t.Fatalf("findCandidates: %v", err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("geocoder called %d times while disabled", calls.Load())
+	}
+	if found.Area.Name != "37.79000, -122.40000" {
+		t.Errorf("area name = %q, want the raw coordinates", found.Area.Name)
+	}
+	if len(found.Restaurants) != 3 || found.Filters.MaxDistance != 0 {
+		t.Errorf("distance filter applied: %d restaurants, max distance %v", len(found.Restaurants), found.Filters.MaxDistance)
+	}
+	if len(found.Warnings) != 1 || !strings.Contains(found.Warnings[0], "distance filter ignored") {
+		t.Errorf("warnings = %v, want the ignored distance filter reported", found.Warnings)
+	}
+	for _, r := range found.Restaurants {
+		if r.Distance != 0 {
+			t.Errorf("%s has distance %v, want it unknown", r.Name, r.Distance)
+		}
+	}
+}
+
+func TestGeocodingDisabledEndToEnd(t *testing.T) {
+	t.Setenv("ENABLE_GEOCODING", "false")
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+
+	rec := postChatCompletion(t, `{"location": "San Francisco", "alternatives": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	resp := decodeJSON(t, rec)
+	if _, ok := resp["nearest"]; ok {
+		t.Error("nearest returned without distances")
+	}
+	prompt := stub.received()[0].Messages[0].Content
+	if strings.Contains(prompt, "Distance") || strings.Contains(prompt, "miles") {
+		t.Errorf("prompt mentions distances:\n%s", prompt)
+	}
+	for _, a := range resp["alternatives"].([]interface{}) {
+		if reason := a.(map[string]interface{})["reason"].(string); strings.Contains(reason, "away") {
+			t.Errorf("alternative reason %q mentions a distance", reason)
+		}
+	}
+}
+
+func TestDistancesUseCustomOrigin(t *testing.T) {
+	// Standing at Budget Bites while searching San Francisco.
+	origin := coordinates{Lat: 37.7835, Lon: -122.4089}
+	found, err := findCandidates(context.Background(), RequestBody{Location: "San Francisco", OriginLat: &origin.Lat, OriginLon: &origin.Lon, Sort: "distance"})
+	if err != nil {
+		t.Fatalf("findCandidates: %v", err)
+	}
+	if found.Area.Name != "San Francisco" {
+		t.Errorf("searched %q, want the location", found.Area.Name)
+	}
+	for _, r := range found.Restaurants {
+		want := haversineMiles(origin, coordinates{Lat: r.Lat, Lon: r.Lon})
+		if math.Abs(r.Distance-want) > 1e-9 {
+			t.Errorf("%s distance = %.3f, want %.3f from the origin", r.Name, r.Distance, want)
+		}
+	}
+	if first := found.Restaurants[0]; first.Name != "Budget Bites" || first.Distance > 1e-9 {
+		t.Errorf("closest = %s at %.3f mi, want Budget Bites at the origin", first.Name, first.Distance)
+	}
+
+	found, _ = findCandidates(context.Background(), RequestBody{Location: "San Francisco", Sort: "name"})
+	if d := found.Restaurants[0].Distance; d != 0.8 {
+		t.Errorf("without an origin Budget Bites is %.3f mi away, want the provider's 0.8", d)
+	}
+}
+
+func TestResolveOriginValidation(t *testing.T) {
+	if _, err := resolveOrigin(RequestBody{OriginLat: floatPtr(37)}); err == nil {
+		t.Error("resolveOrigin accepted a latitude without a longitude")
+	}
+	if _, err := resolveOrigin(RequestBody{OriginLat: floatPtr(91), OriginLon: floatPtr(0)}); err == nil {
+		t.Error("resolveOrigin accepted an out-of-range latitude")
+	}
+	if rec := getRestaurantList(t, "location=San+Francisco&origin_lat=37.78&origin_lon=x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad origin_lon: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// callOutcome is the result of one Ollama call.
+type callOutcome struct {
+	at time.Time
+	ok bool
+}
+
+// healthWindow tracks Ollama call outcomes over a sliding time window. Because old outcomes
+// age out, readiness recovers on its own even when a load balancer has stopped sending traffic.
+type healthWindow struct {
+	mu       sync.Mutex
+	outcomes []callOutcome
+}
+
+// ollamaHealth tracks recent Ollama calls for /readyz.
+var ollamaHealth = &healthWindow{}
+
+// record adds one call outcome.
+func (h *healthWindow) record(ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.outcomes = append(h.outcomes, callOutcome{at: time.Now(), ok: ok})
+	h.prune(time.Now())
+}
+
+// prune drops outcomes older than OLLAMA_HEALTH_WINDOW. The caller must hold h.mu.
+func (h *healthWindow) prune(ref time.Time) {
+	cutoff := ref.Add(-envDuration("OLLAMA_HEALTH_WINDOW", time.Minute))
+	i := 0
+	for i < len(h.outcomes) && h.outcomes[i].at.Before(cutoff) {
+		i++
+	}
+	h.outcomes = h.outcomes[i:]
+}
+
+// failureRate returns the failure rate within the window and the number of calls it covers.
+func (h *healthWindow) failureRate() (float64, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune(time.Now())
+	if len(h.outcomes) == 0 {
+		return 0, 0
+	}
+	failures := 0
+	for _, o := range h.outcomes {
+		if !o.ok {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(h.outcomes)), len(h.outcomes)
+}
+
+// healthy reports whether the failure rate is at or below OLLAMA_FAILURE_THRESHOLD (default 0.5).
+// Fewer than OLLAMA_HEALTH_MIN_CALLS (default 5) calls in the window are too few to judge, and count as healthy.
+func (h *healthWindow) healthy() bool {
+	rate, calls := h.failureRate()
+	if calls < envInt("OLLAMA_HEALTH_MIN_CALLS", 5) {
+		return true
+	}
+	return rate <= envFloat("OLLAMA_FAILURE_THRESHOLD", 0.5)
+}
+
+// handleHealthz serves /healthz: 200 whenever the process is up.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz serves /readyz: 503 while the model is warming up or recent Ollama calls
+// fail too often, so a load balancer can route elsewhere until the server is ready.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if warming.Load() {
+		writeWarming(w)
+		return
+	}
+	if !ollamaHealth.healthy() {
+		rate, calls := ollamaHealth.failureRate()
+		http.Error(w, fmt.Sprintf("Ollama failing: %.0f%% of %d recent calls", rate*100, calls), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// warming is true while the WARMUP request is loading the model.
+var warming atomic.Bool
+
+// warmupMiddleware rejects requests with 503 while the model is warming up, so clients
+// retry later instead of waiting on a slow model load.
+func warmupMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if warming.Load() {
+			writeWarming(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeWarming reports that the server is still warming up, suggesting a retry after
+// WARMUP_RETRY_AFTER seconds (default 5).
+func writeWarming(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(envInt("WARMUP_RETRY_AFTER", 5)))
+	http.Error(w, "Model is warming up", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// resetHealth forgets the Ollama calls earlier tests made.
+func resetHealth(t *testing.T) {
+	t.Helper()
+	ollamaHealth.mu.Lock()
+	ollamaHealth.outcomes = nil
+	ollamaHealth.mu.Unlock()
+}
+
+func readyzStatus() int {
+	rec := httptest.NewRecorder()
+	handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rec.Code
+}
+
+func TestReadyzFlipsOnFailureBurstAndRecovers(t *testing.T) {
+	resetHealth(t)
+	t.Setenv("OLLAMA_HEALTH_WINDOW", "100ms")
+	if code := readyzStatus(); code != http.StatusOK {
+		t.Fatalf("readyz = %d with no calls, want 200", code)
+	}
+
+	for i := 0; i < 5; i++ {
+		ollamaHealth.record(false)
+	}
+	if code := readyzStatus(); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz = %d after a burst of failures, want 503", code)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if code := readyzStatus(); code != http.StatusOK {
+		t.Errorf("readyz = %d once the failures aged out, want 200", code)
+	}
+}
+
+func TestReadyzRecoversAsCallsSucceed(t *testing.T) {
+	resetHealth(t)
+	t.Setenv("OLLAMA_FAILURE_THRESHOLD", "0.5")
+	for i := 0; i < 5; i++ {
+		ollamaHealth.record(false)
+	}
+	if code := readyzStatus(); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz = %d, want 503", code)
+	}
+	for i := 0; i < 5; i++ {
+		ollamaHealth.record(true)
+	}
+	if code := readyzStatus(); code != http.StatusOK {
+		t.Errorf("readyz = %d at a 50%% failure rate, want 200", code)
+	}
+}
+
+func TestTooFewCallsCountAsHealthy(t *testing.T) {
+	resetHealth(t)
+	t.Setenv("OLLAMA_HEALTH_MIN_CALLS", "3")
+	ollamaHealth.record(false)
+	ollamaHealth.record(false)
+	if code := readyzStatus(); code != http.StatusOK {
+		t.Errorf("readyz = %d after two calls, want 200 below the minimum", code)
+	}
+	ollamaHealth.record(false)
+	if code := readyzStatus(); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz = %d after three failures, want 503", code)
+	}
+}
+
+func TestWarmingStates(t *testing.T) {
+	resetHealth(t)
+	t.Setenv("WARMUP_RETRY_AFTER", "7")
+	t.Cleanup(func() { warming.Store(false) })
+	chat := warmupMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served\n"))
+	}))
+	serveChat := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		chat.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+		return rec
+	}
+	healthz := func() int {
+		rec := httptest.NewRecorder()
+		handleHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+
+	warming.Store(true)
+	if rec := serveChat(); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "7" {
+		t.Errorf("chat while warming = %d, Retry-After %q, want 503 and 7", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if code := readyzStatus(); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz while warming = %d, want 503", code)
+	}
+	if code := healthz(); code != http.StatusOK {
+		t.Errorf("healthz while warming = %d, want 200", code)
+	}
+
+	warming.Store(false)
+	if rec := serveChat(); rec.Code != http.StatusOK || rec.Body.String() != "served\n" {
+		t.Errorf("chat once warmed = %d %q, want it served", rec.Code, rec.Body)
+	}
+	if code := readyzStatus(); code != http.StatusOK {
+		t.Errorf("readyz once warmed = %d, want 200", code)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// OpeningHours is one opening period in the restaurant's local time. A Close earlier than
+// Open means the period runs past midnight into the next day.
+type OpeningHours struct {
+	Day   time.Weekday `json:"day"`   // 0 is Sunday
+	Open  string       `json:"open"`  // "HH:MM"
+	Close string       `json:"close"` // "HH:MM"
+}
+
+// everyDay returns the same opening period for all seven days, for providers (and the
+// stub) without per-day hours.
+func everyDay(open, close string) []OpeningHours {
+	hours := make([]OpeningHours, 7)
+	for d := range hours {
+		hours[d] = OpeningHours{Day: time.Weekday(d), Open: open, Close: close}
+	}
+	return hours
+}
+
+// clockOn returns the time hhmm on the calendar day of day, in day's location.
+func clockOn(day time.Time, hhmm string) (time.Time, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(hhmm, "%d:%d", &h, &m); err != nil || h < 0 || h > 24 || m < 0 || m > 59 {
+		return time.Time{}, fmt.Errorf("invalid time %q", hhmm)
+	}
+	y, mo, d := day.Date()
+	return time.Date(y, mo, d, h, m, 0, 0, day.Location()), nil
+}
+
+// closesIn returns how long until r closes if it is open at t, which should already be
+// in the restaurant's time zone. It returns false when r is closed or has no parseable hours.
+func closesIn(r Restaurant, t time.Time) (time.Duration, bool) {
+	// A period that started yesterday may still be running past midnight.
+	for _, start := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		for _, h := range r.Hours {
+			if h.Day != start.Weekday() {
+				continue
+			}
+			open, err := clockOn(start, h.Open)
+			if err != nil {
+				continue
+			}
+			close, err := clockOn(start, h.Close)
+			if err != nil {
+				continue
+			}
+			if !close.After(open) {
+				close = close.AddDate(0, 0, 1)
+			}
+			if !t.Before(open) && t.Before(close) {
+				return close.Sub(t), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// annotateClosingSoon sets ClosesInMinutes on each restaurant that closes within
+// CLOSING_SOON_MINUTES (default 30) of the current time in loc.
+func annotateClosingSoon(restaurants []Restaurant, loc *time.Location) {
+	threshold := time.Duration(envInt("CLOSING_SOON_MINUTES", 30)) * time.Minute
+	t := now().In(loc)
+	for i := range restaurants {
+		if left, open := closesIn(restaurants[i], t); open && left <= threshold {
+			restaurants[i].ClosesInMinutes = intPtr(int(left.Minutes()))
+		}
+	}
+}
+
+// closedAt reports whether r is known to be closed at t. Restaurants without hours are
+// assumed open.
+func closedAt(r Restaurant, t time.Time) bool {
+	if len(r.Hours) == 0 {
+		return false
+	}
+	_, open := closesIn(r, t)
+	return !open
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClosingSoon(t *testing.T) {
+	setClock(t, time.Date(2024, 5, 1, 21, 40, 0, 0, time.UTC))
+	restaurants := []Restaurant{
+		{Name: "Early", Hours: everyDay("11:00", "22:00")},
+		{Name: "Late", Hours: everyDay("17:00", "00:30")},
+		{Name: "No hours"},
+	}
+	annotateClosingSoon(restaurants, time.UTC)
+	if got := restaurants[0].ClosesInMinutes; got == nil || *got != 20 {
+		t.Errorf("Early closes in %v, want 20 minutes", got)
+	}
+	if got := restaurants[1].ClosesInMinutes; got != nil {
+		t.Errorf("Late closes in %d minutes, want no annotation", *got)
+	}
+	if restaurants[2].ClosesInMinutes != nil {
+		t.Error("restaurant without hours annotated")
+	}
+
+	line := restaurantLine(restaurants[0], promptInput{})
+	if !strings.Contains(line, "Closing soon: closes in 20 min.") {
+		t.Errorf("prompt line lacks the annotation: %q", line)
+	}
+	if line := restaurantLine(restaurants[1], promptInput{}); strings.Contains(line, "Closing soon") {
+		t.Errorf("late place annotated: %q", line)
+	}
+}
+
+func TestClosingSoonPastMidnight(t *testing.T) {
+	t.Setenv("CLOSING_SOON_MINUTES", "45")
+	// Tuesday 00:05: the Monday evening period is still running.
+	setClock(t, time.Date(2024, 4, 30, 0, 5, 0, 0, time.UTC))
+	restaurants := []Restaurant{{Name: "Late", Hours: []OpeningHours{{Day: time.Monday, Open: "17:00", Close: "00:30"}}}}
+	annotateClosingSoon(restaurants, time.UTC)
+	if got := restaurants[0].ClosesInMinutes; got == nil || *got != 25 {
+		t.Errorf("Late closes in %v, want 25 minutes", got)
+	}
+	if closedAt(restaurants[0], now()) {
+		t.Error("Late reported closed after midnight")
+	}
+	if !closedAt(restaurants[0], now().Add(time.Hour)) {
+		t.Error("Late reported open at 01:05")
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// httpClient is shared by all outbound calls (Ollama, geocoder, weather) so connections
+// are pooled and kept warm across requests. Per-call deadlines come from each request's
+// context, so the client itself has no overall timeout.
+var httpClient = newHTTPClient()
+
+// newHTTPClient builds a client whose transport keeps more idle connections per host
+// than the default of 2, which matters when many requests go to one Ollama instance:
+//
+//	HTTP_MAX_IDLE_CONNS           idle connections across all hosts (default 100)
+//	HTTP_MAX_IDLE_CONNS_PER_HOST  idle connections per host (default 32)
+//	HTTP_IDLE_CONN_TIMEOUT        how long an idle connection is kept (default 90s)
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = envInt("HTTP_MAX_IDLE_CONNS", 100)
+	transport.MaxIdleConnsPerHost = envInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 32)
+	transport.IdleConnTimeout = envDuration("HTTP_IDLE_CONN_TIMEOUT", 90*time.Second)
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientTransport(t *testing.T) {
+	check := func(maxIdle, perHost int, idle time.Duration) {
+		t.Helper()
+		client := newHTTPClient()
+		transport, ok := client.Transport.(*http.Transport)
+		if !ok {
+			t.Fatalf("transport is %T, want *http.Transport", client.Transport)
+		}
+		if transport.MaxIdleConns != maxIdle || transport.MaxIdleConnsPerHost != perHost || transport.IdleConnTimeout != idle {
+			t.Errorf("transport = %d idle, %d per host, %s timeout; want %d, %d, %s",
+				transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout, maxIdle, perHost, idle)
+		}
+		if client.Timeout != 0 {
+			t.Errorf("client timeout = %s, want none", client.Timeout)
+		}
+	}
+	check(100, 32, 90*time.Second)
+
+	t.Setenv("HTTP_MAX_IDLE_CONNS", "10")
+	t.Setenv("HTTP_MAX_IDLE_CONNS_PER_HOST", "4")
+	t.Setenv("HTTP_IDLE_CONN_TIMEOUT", "15s")
+	check(10, 4, 15*time.Second)
+}
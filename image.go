@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// imageTypes are the image formats accepted in multipart chat requests.
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// isMultipart reports whether r carries a multipart/form-data body.
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// decodeMultipartRequest reads a multipart/form-data chat request with "location" and
+// "query" fields, optional "model" and "profile" fields, and an optional "image" file of at
+// most IMAGE_MAX_BYTES (default 5 MiB). The image must be JPEG, PNG or WebP, judged by its
+// content rather than its declared type.
+func decodeMultipartRequest(r *http.Request) (RequestBody, error) {
+	maxBytes := int64(envInt("IMAGE_MAX_BYTES", 5<<20))
+	// Leave room for the text fields and multipart framing on top of the image itself.
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBytes+64<<10)
+	if err := r.ParseMultipartForm(maxBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return RequestBody{}, &httpError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("image exceeds %d bytes", maxBytes)}
+		}
+		return RequestBody{}, badRequest("Invalid multipart request body")
+	}
+	reqData := RequestBody{
+		Version:  currentRequestVersion,
+		Location: r.FormValue("location"),
+		Query:    r.FormValue("query"),
+		Model:    r.FormValue("model"),
+		Profile:  r.FormValue("profile"),
+	}
+
+	file, header, err := r.FormFile("image")
+	if errors.Is(err, http.ErrMissingFile) {
+		return reqData, nil
+	}
+	if err != nil {
+		return RequestBody{}, badRequest("Invalid image upload")
+	}
+	defer file.Close()
+	if header.Size > maxBytes {
+		return RequestBody{}, &httpError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("image exceeds %d bytes", maxBytes)}
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return RequestBody{}, badRequest("Invalid image upload")
+	}
+	if len(data) == 0 {
+		return RequestBody{}, badRequest("image is empty")
+	}
+	if kind := http.DetectContentType(data); !imageTypes[kind] {
+		return RequestBody{}, &httpError{Status: http.StatusUnsupportedMediaType, Message: fmt.Sprintf("unsupported image type %s", kind)}
+	}
+	reqData.Images = []string{base64.StdEncoding.EncodeToString(data)}
+	return reqData, nil
+}
+
+// visionModel reports whether model accepts images, judged by its name without the tag
+// against VISION_MODELS (comma-separated, default "llava,llama3.2-vision,moondream").
+func visionModel(model string) bool {
+	list := os.Getenv("VISION_MODELS")
+	if list == "" {
+		list = "llava,llama3.2-vision,moondream"
+	}
+	name, _, _ := strings.Cut(model, ":")
+	for _, m := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(m), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// attachImages adds images to the last message of chatReq, which carries the prompt, when
+// the model supports vision. Otherwise the images are dropped and the request proceeds as
+// text; handleRequest warns the client about that.
+func attachImages(chatReq *ChatRequest, images []string) {
+	if len(images) == 0 || len(chatReq.Messages) == 0 {
+		return
+	}
+	if !visionModel(chatReq.Model) {
+		log.Printf("Ignoring image: model %s does not support vision", chatReq.Model)
+		return
+	}
+	chatReq.Messages[len(chatReq.Messages)-1].Images = images
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// tinyPNG is enough of a PNG for content sniffing.
+var tinyPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+
+// postMultipart sends a multipart chat request with fields and, if image is non-nil, an
+// image file.
+func postMultipart(t *testing.T, fields map[string]string, image []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	if image != nil {
+		fw, err := mw.CreateFormFile("image", "photo.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(image)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handleRequest(rec, req)
+	return rec
+}
+
+func TestMultipartImageReachesVisionModel(t *testing.T) {
+	stub := newOllamaStub(t, reply("That dish is at Fancy Eats."))
+	rec := postMultipart(t, map[string]string{"location": "San Francisco", "query": "where is this from", "model": "llava:13b"}, tinyPNG)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	sent := stub.received()[0]
+	prompt := sent.Messages[len(sent.Messages)-1]
+	if len(prompt.Images) != 1 || prompt.Images[0] != base64.StdEncoding.EncodeToString(tinyPNG) {
+		t.Errorf("images = %v, want the upload base64-encoded", prompt.Images)
+	}
+}
+
+func TestMultipartWithoutImage(t *testing.T) {
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	rec := postMultipart(t, map[string]string{"location": "San Francisco"}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if sent := stub.received()[0]; len(sent.Messages[0].Images) != 0 {
+		t.Error("images sent without an upload")
+	}
+}
+
+func TestMultipartImageValidation(t *testing.T) {
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	if rec := postMultipart(t, map[string]string{"location": "San Francisco"}, []byte("GIF89a not allowed")); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("GIF upload: status %d, want 415", rec.Code)
+	}
+	t.Setenv("IMAGE_MAX_BYTES", "16")
+	if rec := postMultipart(t, map[string]string{"location": "San Francisco"}, tinyPNG); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload: status %d, want 413", rec.Code)
+	}
+	t.Setenv("IMAGE_MAX_BYTES", "")
+
+	rec := postMultipart(t, map[string]string{"location": "San Francisco", "model": "llama3.2"}, tinyPNG)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if sent := stub.received(); len(sent[0].Messages[0].Images) != 0 {
+		t.Error("image sent to a model without vision")
+	}
+	warnings, _ := decodeJSON(t, rec)["warnings"].([]interface{})
+	if len(warnings) != 1 || warnings[0] != "image ignored: model llama3.2 does not support images" {
+		t.Errorf("warnings = %v", warnings)
+	}
+}
+
+func TestImagesAreKeyedInResponseCache(t *testing.T) {
+	t.Setenv("RESPONSE_CACHE_TTL", "1m")
+	seed := int64(1)
+	chatReq := ChatRequest{Model: "llava"}
+	in := promptInput{Restaurants: []Restaurant{{Name: "Fancy Eats"}}}
+	key := func(images ...string) string {
+		return responseCacheKey(RequestBody{Location: "San Francisco", Seed: &seed, Images: images}, chatReq, in)
+	}
+	photo := base64.StdEncoding.EncodeToString(tinyPNG)
+	other := base64.StdEncoding.EncodeToString(append([]byte("\x89PNG\r\n\x1a\n"), 1))
+	if key(photo) == key() || key(photo) == key(other) {
+		t.Error("requests with different images share a cache key")
+	}
+	if key(photo) != key(photo) {
+		t.Error("the same image gives different cache keys")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// languageNames maps primary language subtags to the name used in the prompt. Tags not
+// listed are passed to the model as-is, which most models understand.
+var languageNames = map[string]string{
+	"de": "German", "en": "English", "es": "Spanish", "fr": "French", "it": "Italian",
+	"ja": "Japanese", "ko": "Korean", "nl": "Dutch", "pl": "Polish", "pt": "Portuguese",
+	"ru": "Russian", "sv": "Swedish", "tr": "Turkish", "zh": "Chinese",
+}
+
+// resolveLanguage picks the reply language: the request's language field, then the
+// Accept-Language header, then DEFAULT_LANGUAGE. It returns "" when none is set, in
+// which case the prompt carries no language instruction.
+func resolveLanguage(field string, r *http.Request) string {
+	if field = strings.TrimSpace(field); field != "" {
+		return field
+	}
+	if tag := preferredLanguage(r.Header.Get("Accept-Language")); tag != "" {
+		return tag
+	}
+	return strings.TrimSpace(os.Getenv("DEFAULT_LANGUAGE"))
+}
+
+// preferredLanguage returns the acceptable tag with the highest quality in an
+// Accept-Language header, e.g. "fr-CH" for "fr-CH, fr;q=0.9, en;q=0.8". Wildcards
+// and tags with q=0 are skipped. Ties keep header order.
+func preferredLanguage(header string) string {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{tag, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0].tag
+}
+
+// languageName returns the prompt name for a language tag such as "pt-BR" ("Portuguese").
+func languageName(tag string) string {
+	primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+	if name, ok := languageNames[primary]; ok {
+		return name
+	}
+	return tag
+}
+
+// englishReply reports whether a reply in tag is English, the only language the
+// server's own templated text is written in. An empty tag means no preference.
+func englishReply(tag string) bool {
+	primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+	return primary == "" || primary == "en"
+}
+
+// checkLanguages validates the languages field: at most MAX_LANGUAGES (default 3)
+// non-empty tags.
+func checkLanguages(langs []string) error {
+	if limit := envInt("MAX_LANGUAGES", 3); len(langs) > limit {
+		return badRequest(fmt.Sprintf("at most %d languages may be requested", limit))
+	}
+	for _, lang := range langs {
+		if strings.TrimSpace(lang) == "" {
+			return badRequest("languages must not contain empty tags")
+		}
+	}
+	return nil
+}
+
+// generateVariants starts generating the recommendation for each of langs concurrently,
+// each with its own prompt and model call, and returns a function that waits for them.
+// The wait function returns the finished text by language plus a warning for each
+// language that failed. finish turns raw model content into response text.
+func generateVariants(ctx context.Context, reqData RequestBody, in promptInput, langs []string, finish func(string) string) func() (map[string]string, []string) {
+	type variant struct {
+		lang string
+		text string
+		err  error
+	}
+	results := make(chan variant, len(langs))
+	for _, lang := range langs {
+		go func(lang string) {
+			vin := in
+			vin.Language = lang
+			chatReq, err := buildChatRequest(reqData, buildPrompt(vin))
+			if err != nil {
+				results <- variant{lang: lang, err: err}
+				return
+			}
+			chatResp, _, err := callOllama(ctx, chatReq)
+			if err != nil {
+				results <- variant{lang: lang, err: err}
+				return
+			}
+			results <- variant{lang: lang, text: finish(chatResp.Message.Content)}
+		}(lang)
+	}
+
+	return func() (map[string]string, []string) {
+		texts := make(map[string]string, len(langs))
+		var warnings []string
+		for range langs {
+			v := <-results
+			if v.err != nil {
+				log.Printf("Generating %s variant failed: %v", v.lang, v.err)
+				warnings = append(warnings, fmt.Sprintf("translation to %q unavailable", v.lang))
+				continue
+			}
+			texts[v.lang] = v.text
+		}
+		return texts, warnings
+	}
+}
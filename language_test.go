@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveLanguage(t *testing.T) {
+	withHeader := func(header string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if header != "" {
+			r.Header.Set("Accept-Language", header)
+		}
+		return r
+	}
+	t.Setenv("DEFAULT_LANGUAGE", "de")
+	tests := []struct {
+		field, header, want string
+	}{
+		{"", "fr-CH, fr;q=0.9, en;q=0.8", "fr-CH"},
+		{"", "en;q=0.5, ja", "ja"},
+		{"", "*, es;q=0", "de"},
+		{"it", "fr-CH, fr;q=0.9", "it"},
+		{"", "", "de"},
+	}
+	for _, tt := range tests {
+		if got := resolveLanguage(tt.field, withHeader(tt.header)); got != tt.want {
+			t.Errorf("resolveLanguage(%q, %q) = %q, want %q", tt.field, tt.header, got, tt.want)
+		}
+	}
+	t.Setenv("DEFAULT_LANGUAGE", "")
+	if got := resolveLanguage("", withHeader("")); got != "" {
+		t.Errorf("no language anywhere gave %q", got)
+	}
+}
+
+func TestLanguageReachesPrompt(t *testing.T) {
+	stub := newOllamaStub(t, reply("Essayez Fancy Eats."))
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"location": "San Francisco"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Language", "fr-CA,en;q=0.5")
+	rec := httptest.NewRecorder()
+	handleRequest(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if prompt := stub.received()[0].Messages[0].Content; !strings.Contains(prompt, "Respond in French.") {
+		t.Errorf("prompt lacks the language instruction:\n%s", prompt)
+	}
+	if names := languageName("pt-BR") + "," + languageName("tlh"); names != "Portuguese,tlh" {
+		t.Errorf("languageName = %s", names)
+	}
+}
+
+func TestLanguagesProduceTranslations(t *testing.T) {
+	replies := map[string]string{"German": "Probieren Sie Fancy Eats.", "French": "Essayez Fancy Eats.", "Japanese": "Fancy Eatsへどうぞ。"}
+	stub := newOllamaStub(t, func(w http.ResponseWriter, req ChatRequest) {
+		prompt := req.Messages[len(req.Messages)-1].Content
+		for name, text := range replies {
+			if strings.Contains(prompt, "Respond in "+name+".") {
+				writeChatReply(w, req.Model, text)
+				return
+			}
+		}
+		writeChatReply(w, req.Model, "no language")
+	})
+	rec := postChatCompletion(t, `{"location": "San Francisco", "languages": ["fr", "de", "ja"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	resp := decodeJSON(t, rec)
+	if got := messageContent(t, resp); got != replies["French"] {
+		t.Errorf("content = %q, want the first language", got)
+	}
+	want := map[string]interface{}{"fr": replies["French"], "de": replies["German"], "ja": replies["Japanese"]}
+	if got := resp["translations"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("translations = %v, want %v", got, want)
+	}
+	if n := len(stub.received()); n != 3 {
+		t.Errorf("Ollama called %d times, want one per language", n)
+	}
+}
+
+func TestLanguagesAreCapped(t *testing.T) {
+	t.Setenv("MAX_LANGUAGES", "2")
+	if rec := postChatCompletion(t, `{"location": "San Francisco", "languages": ["fr", "de", "ja"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400 for too many languages", rec.Code)
+	}
+	if err := checkLanguages([]string{"fr", " "}); err == nil {
+		t.Error("checkLanguages accepted an empty tag")
+	}
+}
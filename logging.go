@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugf logs only when LOG_LEVEL=debug.
+func debugf(format string, args ...interface{}) {
+	if strings.EqualFold(os.Getenv("LOG_LEVEL"), "debug") {
+		log.Printf("DEBUG "+format, args...)
+	}
+}
+
+// requestTiming accumulates time spent in Ollama calls during one request.
+type requestTiming struct {
+	mu     sync.Mutex
+	ollama time.Duration
+}
+
+type timingKey struct{}
+
+// addOllamaTime records d as Ollama time for the request carried by ctx, if any.
+func addOllamaTime(ctx context.Context, d time.Duration) {
+	if t, ok := ctx.Value(timingKey{}).(*requestTiming); ok {
+		t.mu.Lock()
+		t.ollama += d
+		t.mu.Unlock()
+	}
+}
+
+// loggingMiddleware logs each request at info level when it takes longer than
+// SLOW_REQUEST_THRESHOLD (default 2s) and at debug level otherwise. The log line
+// always includes the time spent waiting on Ollama.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timing := &requestTiming{}
+		r = r.WithContext(context.WithValue(r.Context(), timingKey{}, timing))
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		start := time.Now()
+		next.ServeHTTP(sw, r)
+		elapsed := time.Since(start)
+
+		timing.mu.Lock()
+		ollama := timing.ollama
+		timing.mu.Unlock()
+
+		writeAccessLog(accessLogEntry{
+			Time:       start,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     sw.status,
+			DurationMS: elapsed.Milliseconds(),
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		})
+
+		if elapsed > envDuration("SLOW_REQUEST_THRESHOLD", 2*time.Second) {
+			log.Printf("Slow request: %s %s %d in %s (ollama %s)",
+				r.Method, r.URL.Path, sw.status, elapsed.Round(time.Millisecond), ollama.Round(time.Millisecond))
+			return
+		}
+		debugf("Request: %s %s %d in %s (ollama %s)",
+			r.Method, r.URL.Path, sw.status, elapsed.Round(time.Millisecond), ollama.Round(time.Millisecond))
+	})
+}
+
+// statusWriter records the status code written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
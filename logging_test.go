@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs redirects the standard logger into the returned buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestOnlySlowRequestsLogAtInfo(t *testing.T) {
+	t.Setenv("SLOW_REQUEST_THRESHOLD", "50ms")
+	logs := captureLogs(t)
+	handler := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			addOllamaTime(r.Context(), 70*time.Millisecond)
+			time.Sleep(80 * time.Millisecond)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if logs.Len() != 0 {
+		t.Errorf("fast request was logged at info: %s", logs)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if got := logs.String(); !strings.Contains(got, "Slow request: GET /slow 200") || !strings.Contains(got, "(ollama 70ms)") {
+		t.Errorf("slow request log = %q, want the request and its Ollama time", got)
+	}
+}
+
+func TestFastRequestsLogAtDebug(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "debug")
+	logs := captureLogs(t)
+	handler := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if got := logs.String(); !strings.Contains(got, "DEBUG Request: GET /fast 200") {
+		t.Errorf("debug log = %q, want the fast request", got)
+	}
+}
@@ -2,43 +2,153 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
 // RequestBody defines the JSON structure for incoming requests.
 type RequestBody struct {
-	Location string `json:"location"` // e.g., "San Francisco, CA"
-	Query    string `json:"query"`    // additional preferences (optional)
+	Version int `json:"version"` // request schema version, default 1; see decodeRequest (optional)
+
+	Location string   `json:"location"` // e.g., "San Francisco, CA"
+	Lat      *float64 `json:"lat"`      // search center latitude; with lon, preferred over location (optional)
+	Lon      *float64 `json:"lon"`      // search center longitude (optional)
+	Query    string   `json:"query"`    // additional preferences (optional)
+	Seed     *int64   `json:"seed"`     // makes random choices and model sampling reproducible (optional)
+	Variety  bool     `json:"variety"`  // feature a weighted-random pick instead of always the top one (optional)
+	Units    string   `json:"units"`    // distance units, "mi" (default) or "km" (optional)
+	Cuisine  string   `json:"cuisine"`  // only keep restaurants of this cuisine; overrides one named in the query (optional)
+	Sort     string   `json:"sort"`     // "score" (default), "rating", "distance", "price" or "none" (optional)
+	Meal     string   `json:"meal"`     // "breakfast", "lunch" or "dinner"; inferred from the time when empty (optional)
+	Prefer   string   `json:"prefer"`   // what the model should favor between similar options: "distance", "rating", "price" or "wait" (optional)
+
+	OriginLat *float64 `json:"origin_lat"` // where the user is, for distances; defaults to the search center (optional)
+	OriginLon *float64 `json:"origin_lon"` // user longitude, with origin_lat (optional)
+
+	ShuffleSeed *int64 `json:"shuffle_seed"` // shuffle the ranked results, in the same order for the same seed (optional)
+
+	IncludeReasoning bool `json:"include_reasoning"` // return the model's <think> output in message.reasoning (optional)
+
+	MaxWait  *int     `json:"max_wait"`  // drop restaurants with a known wait longer than this many minutes (optional)
+	Features []string `json:"features"`  // only keep restaurants offering all of these features (optional)
+	MinPrice float64  `json:"min_price"` // dollars; disables price inference from the query (optional)
+	MaxPrice float64  `json:"max_price"` // dollars; disables price inference from the query (optional)
+	Pin      []string `json:"pin"`       // restaurant names always shown to the model, whatever the filters (optional)
+
+	Preferences map[string]float64 `json:"preferences"` // score weights for "rating", "distance" and "price", overriding the configured ones (optional)
+	Family      bool               `json:"family"`      // boost kid-friendly places in the ranking (optional)
+
+	User string `json:"user"` // OpenAI-style end-user identifier for abuse monitoring; only logged hashed (optional)
+
+	Model       string   `json:"model"`       // Ollama model, overrides the profile and OLLAMA_MODEL (optional)
+	Profile     string   `json:"profile"`     // named settings bundle from MODEL_PROFILES (optional)
+	Language    string   `json:"language"`    // reply language tag such as "fr"; overrides Accept-Language and DEFAULT_LANGUAGE (optional)
+	Languages   []string `json:"languages"`   // reply in each of these; the first is message.content, all are in translations (optional)
+	Tone        string   `json:"tone"`        // "precise", "balanced" or "creative"; see tonePresets (optional)
+	Temperature *float64 `json:"temperature"` // sampling temperature, overrides the profile and tone (optional)
+	MaxTokens   *int     `json:"max_tokens"`  // cap on generated tokens, overrides the profile (optional)
+
+	Tools      []json.RawMessage `json:"tools"`       // OpenAI-style tool definitions forwarded to the model (optional)
+	ToolChoice json.RawMessage   `json:"tool_choice"` // only "none" is honored; see toolsEnabled (optional)
+
+	DryRun       bool `json:"dry_run"`       // build the prompt and estimate its size without generating (optional)
+	Debug        bool `json:"debug"`         // include the raw Ollama reply in debug.raw_ollama; needs DEBUG_ENDPOINTS=true (optional)
+	Alternatives bool `json:"alternatives"`  // include runner-up restaurants in a top-level alternatives field (optional)
+	AlwaysUseAI  bool `json:"always_use_ai"` // call the model even when only one restaurant matches (optional)
+	Surprise     bool `json:"surprise"`      // ignore filters and present one random, well-rated, open restaurant (optional)
+	Structured   bool `json:"structured"`    // ask for a JSON pick and return it as a top-level recommendation (optional)
+
+	PostProcess []string `json:"postprocess"` // content processing steps, overriding POSTPROCESS; see postProcessSteps (optional)
+	MaxLength   int      `json:"max_length"`  // character cap used by the max_length step (optional)
+	Summary     bool     `json:"summary"`     // reply with one short sentence, e.g. for SMS or voice (optional)
+
+	ResponseStyle string `json:"response_style"` // "openai" (default) or "simple", overriding RESPONSE_STYLE (optional)
+
+	Metadata json.RawMessage `json:"metadata"` // opaque JSON object echoed back in the response, never sent to the model (optional)
+
+	Images []string `json:"-"` // base64-encoded images from a multipart request, never read from JSON
+
+	OllamaOptions map[string]interface{} `json:"ollama_options"` // raw Ollama options, honored only with ALLOW_RAW_OPTIONS=true (optional)
 }
 
 // Restaurant represents a simple restaurant object.
 type Restaurant struct {
 	Name     string   `json:"name"`
-	Address  string   `json:"address"`
+	Cuisine  string   `json:"cuisine,omitempty"` // lowercase, e.g. "italian"
+	Address  string   `json:"address"`           // formatted from the components below via formatAddress
 	Price    float64  `json:"price"`
 	Rating   float64  `json:"rating"`
-	Distance float64  `json:"distance"`
-	Reviews  []string `json:"reviews"`
+	Distance float64  `json:"distance"` // miles
+	Reviews  []Review `json:"reviews"`
+
+	DistanceKm float64 `json:"distance_km,omitempty"` // Distance converted to kilometers at the response edge
+
+	WaitMinutes *int     `json:"wait_minutes,omitempty"` // typical current wait from popularity data; nil when unknown
+	Features    []string `json:"features,omitempty"`     // e.g. "outdoor_seating", "accepts_cards", "wheelchair_accessible", "delivery"
+	Sentiment   *float64 `json:"sentiment,omitempty"`    // review sentiment from -1 to 1; nil when not scored
+	Reason      string   `json:"reason,omitempty"`       // why it ranks where it does, from explainRank; list endpoint with explain=true only
+	Pinned      bool     `json:"pinned,omitempty"`       // named in the request's pin list, so kept regardless of filters
+	Unmatched   bool     `json:"-"`                      // pinned although it fails the request's filters
+
+	Lat float64 `json:"lat,omitempty"` // WGS84 coordinates; both zero when unknown
+	Lon float64 `json:"lon,omitempty"`
+
+	Timezone string `json:"timezone,omitempty"` // IANA zone, e.g. "America/Los_Angeles"; used for time-based features
+
+	Hours           []OpeningHours `json:"hours,omitempty"`             // weekly opening periods in local time; nil when unknown
+	ClosesInMinutes *int           `json:"closes_in_minutes,omitempty"` // set when the place closes within CLOSING_SOON_MINUTES
+
+	// Structured address components, populated by providers.
+	Street     string `json:"street,omitempty"`
+	City       string `json:"city,omitempty"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// formatAddress builds a single-line address from r's components, skipping any that are empty,
+// e.g. "123 Main St, San Francisco, CA 94105, USA".
+func formatAddress(r Restaurant) string {
+	region := strings.TrimSpace(r.State + " " + r.PostalCode)
+	var parts []string
+	for _, p := range []string{r.Street, r.City, region, r.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
 }
 
 // ChatMessage represents a single chat message.
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"` // base64-encoded images, for vision models
 }
 
 // ChatRequest defines the payload sent to the Ollama chat endpoint.
 type ChatRequest struct {
-	Model    string        `json:"model"`
-	Messages []ChatMessage `json:"messages"`
-	Stream   bool          `json:"stream"`
+	Model     string                 `json:"model"`
+	Messages  []ChatMessage          `json:"messages"`
+	Stream    bool                   `json:"stream"`
+	Options   map[string]interface{} `json:"options,omitempty"` // Ollama generation options, e.g. "temperature"
+	Tools     []json.RawMessage      `json:"tools,omitempty"`
+	Format    json.RawMessage        `json:"format,omitempty"`     // JSON schema the reply must match
+	KeepAlive string                 `json:"keep_alive,omitempty"` // how long Ollama keeps the model loaded afterwards
 }
 
 // ChatResponse defines the expected response from the Ollama chat endpoint.
@@ -46,124 +156,796 @@ type ChatResponse struct {
 	Model     string `json:"model"`
 	CreatedAt string `json:"created_at"`
 	Message   struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
+		Role      string           `json:"role"`
+		Content   string           `json:"content"`
+		ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
 	} `json:"message"`
-	Done bool `json:"done"`
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"` // set by Ollama when the request failed
+
+	Raw []byte `json:"-"` // the undecoded response body
+}
+
+// ollamaError is returned when Ollama answers with a non-200 status or an error message.
+type ollamaError struct {
+	StatusCode int
+	Message    string
 }
 
-// getRestaurants simulates fetching restaurant data for a given location.
-// Replace this stub with real API calls (e.g., Yelp, Google Places) as needed.
-func getRestaurants(location string) ([]Restaurant, error) {
+func (e *ollamaError) Error() string {
+	return fmt.Sprintf("Ollama returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// shouldFallback reports whether err means the model itself couldn't serve the request
+// (not found, out of memory), in which case retrying with a smaller model may help.
+func shouldFallback(err error) bool {
+	var oe *ollamaError
+	if !errors.As(err, &oe) {
+		return false
+	}
+	if oe.StatusCode == http.StatusNotFound {
+		return true
+	}
+	msg := strings.ToLower(oe.Message)
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "memory")
+}
+
+// fetchOptions are the limits passed to a provider. Providers should translate them into
+// their API's own parameters where supported; fetchRestaurants enforces them regardless.
+type fetchOptions struct {
+	Limit      int // maximum number of restaurants to return; zero means no limit
+	MaxReviews int // maximum number of reviews per restaurant; zero means no limit
+}
+
+// getRestaurants simulates fetching restaurant data for a given search area.
+// Replace this stub with real API calls (e.g., Yelp, Google Places) as needed;
+// they should be made with ctx so PROVIDER_TIMEOUT applies.
+func getRestaurants(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	restaurants := []Restaurant{
-		{"The Gourmet Spot", "123 Main St", 25.0, 4.5, 0.5, []string{"Great food!", "Excellent service!"}},
-		{"Budget Bites", "456 Elm St", 15.0, 4.0, 0.8, []string{"Affordable and tasty.", "Good value!"}},
-		{"Fancy Eats", "789 Oak St", 40.0, 4.7, 1.2, []string{"High-end experience.", "Loved the ambiance!"}},
+		{
+			Name: "The Gourmet Spot", Cuisine: "american", Street: "123 Main St",
+			Price: 25.0, Rating: 4.5, Distance: 0.5, Lat: 37.7907, Lon: -122.3996,
+			Reviews:     []Review{{Text: "Great food!", Date: daysAgo(3)}, {Text: "Excellent service!", Date: daysAgo(40)}},
+			WaitMinutes: intPtr(20),
+			Features:    []string{"accepts_cards", "outdoor_seating", "wheelchair_accessible"},
+			Hours:       everyDay("11:00", "22:00"),
+		},
+		{
+			Name: "Budget Bites", Cuisine: "italian", Street: "456 Elm St",
+			Price: 15.0, Rating: 4.0, Distance: 0.8, Lat: 37.7835, Lon: -122.4089,
+			Reviews:     []Review{{Text: "Affordable and tasty.", Date: daysAgo(200)}, {Text: "Good value!", Date: daysAgo(12)}},
+			WaitMinutes: intPtr(5),
+			Features:    []string{"accepts_cards", "delivery", "kid_friendly"},
+			Hours:       everyDay("10:00", "23:00"),
+		},
+		{
+			Name: "Fancy Eats", Cuisine: "french", Street: "789 Oak St",
+			Price: 40.0, Rating: 4.7, Distance: 1.2, Lat: 37.7996, Lon: -122.4170,
+			Reviews: []Review{{Text: "High-end experience.", Date: daysAgo(1)}, {Text: "Loved the ambiance!", Date: daysAgo(90)}},
+			Hours:   everyDay("17:00", "00:30"),
+		},
+	}
+	for i := range restaurants {
+		restaurants[i].Address = formatAddress(restaurants[i])
+		restaurants[i].Timezone = "America/Los_Angeles" // the sample data is in San Francisco
+	}
+	if opts.Limit > 0 && len(restaurants) > opts.Limit {
+		restaurants = restaurants[:opts.Limit]
+	}
+	if opts.MaxReviews > 0 {
+		for i := range restaurants {
+			restaurants[i].Reviews = recentReviews(restaurants[i].Reviews, opts.MaxReviews)
+		}
 	}
 	return restaurants, nil
 }
 
-// callOllama constructs a chat request and sends it to the Ollama /api/chat endpoint.
-// It extracts and returns the assistant's message content.
-func callOllama(prompt string) (string, error) {
-	// Use a default model (or set via OLLAMA_MODEL environment variable)
-	model := os.Getenv("OLLAMA_MODEL")
-	if model == "" {
-		model = "llama3.2"
+// parseOllamaURL parses and validates an Ollama base URL, defaulting to localhost when raw is empty.
+// The URL may carry a path prefix (e.g. "https://ai.example.com/ollama") when Ollama sits behind a proxy.
+func parseOllamaURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		raw = "http://localhost:11434"
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OLLAMA_URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OLLAMA_URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid OLLAMA_URL %q: missing host", raw)
+	}
+	return u, nil
+}
+
+// ollamaEndpoint joins an API path such as "/api/chat" onto the first configured Ollama
+// base URL, keeping any path prefix the base URL has.
+func ollamaEndpoint(apiPath string) (string, error) {
+	bases, err := ollamaBackends()
+	if err != nil {
+		return "", err
+	}
+	return bases[0].JoinPath(apiPath).String(), nil
+}
+
+// defaultModel returns the model used when a request doesn't pick one (set via OLLAMA_MODEL).
+func defaultModel() string {
+	if model := os.Getenv("OLLAMA_MODEL"); model != "" {
+		return model
+	}
+	return "llama3.2"
+}
+
+// buildChatRequest assembles the Ollama chat request for reqData and its rendered prompt.
+func buildChatRequest(reqData RequestBody, prompt string) (ChatRequest, error) {
+	tone, err := resolveTone(reqData.Tone)
+	if err != nil {
+		return ChatRequest{}, badRequest(err.Error())
+	}
+	profile, err := resolveProfile(reqData.Profile)
+	if err != nil {
+		return ChatRequest{}, err
+	}
+	if profile == nil {
+		profile = &modelProfile{}
 	}
 
 	chatReq := ChatRequest{
-		Model: model,
-		Messages: []ChatMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
+		Model:  defaultModel(),
 		Stream: false,
 	}
+	if profile.Model != "" {
+		chatReq.Model = profile.Model
+	}
+	if reqData.Model != "" {
+		chatReq.Model = reqData.Model
+	}
+	examples, err := loadExamples()
+	if err != nil {
+		return ChatRequest{}, err
+	}
+	// With prompt caching the stable prefix goes first so it is byte-identical across
+	// requests; otherwise the tone leads, as it always has.
+	var toneMessages []ChatMessage
+	if tone != nil {
+		toneMessages = []ChatMessage{{Role: "system", Content: tone.SystemPrompt}}
+	}
+	if promptCacheEnabled() {
+		chatReq.Messages = append(stableMessages(examples), toneMessages...)
+		chatReq.KeepAlive = promptCacheKeepAlive()
+	} else {
+		chatReq.Messages = append(toneMessages, exampleMessages(examples)...)
+	}
+	chatReq.Messages = append(chatReq.Messages, ChatMessage{Role: "user", Content: prompt})
+	attachImages(&chatReq, reqData.Images)
 
-	reqBody, err := json.Marshal(chatReq)
+	// Precedence for each option: explicit request field, then profile, then tone, then
+	// the model's MODEL_DEFAULTS.
+	options, err := modelDefaults(chatReq.Model)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal chat request: %w", err)
+		return ChatRequest{}, err
+	}
+	var temperature *float64
+	if tone != nil {
+		temperature = &tone.Temperature
+	}
+	if profile.Temperature != nil {
+		temperature = profile.Temperature
+	}
+	if reqData.Temperature != nil {
+		temperature = reqData.Temperature
+	}
+	if temperature != nil {
+		if *temperature < 0 || *temperature > 2 {
+			return ChatRequest{}, badRequest("temperature must be between 0 and 2")
+		}
+		options["temperature"] = *temperature
+	}
+	maxTokens := profile.MaxTokens
+	if reqData.MaxTokens != nil {
+		maxTokens = reqData.MaxTokens
+	}
+	if maxTokens != nil {
+		if *maxTokens <= 0 {
+			return ChatRequest{}, badRequest("max_tokens must be positive")
+		}
+		options["num_predict"] = *maxTokens
+	}
+	if reqData.Seed != nil {
+		options["seed"] = *reqData.Seed
 	}
 
-	// Use OLLAMA_URL environment variable if set, otherwise default to localhost.
-	baseURL := os.Getenv("OLLAMA_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:11434"
+	// Raw options win over the ones mapped from request fields.
+	if len(reqData.OllamaOptions) > 0 {
+		if envBool("ALLOW_RAW_OPTIONS") {
+			for k, v := range reqData.OllamaOptions {
+				options[k] = v
+			}
+		} else {
+			log.Printf("Ignoring ollama_options: ALLOW_RAW_OPTIONS is not enabled")
+		}
+	}
+	if len(options) > 0 {
+		chatReq.Options = options
+	}
+	if toolsEnabled(reqData) {
+		chatReq.Tools = reqData.Tools
 	}
-	chatEndpoint := baseURL + "/api/chat"
+	if reqData.Structured {
+		chatReq.Format = recommendationSchema
+	}
+	return chatReq, nil
+}
 
-	resp, err := http.Post(chatEndpoint, "application/json", bytes.NewBuffer(reqBody))
+// callOllama sends chatReq to the Ollama /api/chat endpoint.
+// If the model fails in a way a smaller model could avoid, the request is retried
+// once with FALLBACK_MODEL, unless the request's retry budget is spent. It returns the
+// reply and the model that produced it.
+func callOllama(ctx context.Context, chatReq ChatRequest) (*ChatResponse, string, error) {
+	chatResp, err := sendChat(ctx, chatReq)
 	if err != nil {
-		return "", fmt.Errorf("HTTP POST to Ollama failed: %w", err)
+		fallback := os.Getenv("FALLBACK_MODEL")
+		if fallback == "" || fallback == chatReq.Model || !shouldFallback(err) {
+			return nil, "", err
+		}
+		done, ok := startRetry(ctx, "Ollama call")
+		if !ok {
+			return nil, "", err
+		}
+		log.Printf("Model %s failed (%v), falling back to %s", chatReq.Model, err, fallback)
+		primaryErr := err
+		chatReq.Model = fallback
+		chatResp, err = sendChat(ctx, chatReq)
+		done()
+		if err != nil {
+			return nil, "", fmt.Errorf("fallback model %s failed: %w (primary: %v)", fallback, err, primaryErr)
+		}
 	}
-	defer resp.Body.Close()
+	return chatResp, chatReq.Model, nil
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// sendChat posts chatReq to the /api/chat endpoint of the next Ollama backend and decodes
+// the reply, recording the call's latency and outcome.
+func sendChat(ctx context.Context, chatReq ChatRequest) (*ChatResponse, error) {
+	bases, err := ollamaBackends()
 	if err != nil {
-		return "", fmt.Errorf("failed to read Ollama response body: %w", err)
+		return nil, err
 	}
+	base := backends.pick(bases)
 
-	log.Printf("Ollama raw response: %s", string(body))
+	start := time.Now()
+	chatResp, err := postChat(ctx, base, chatReq)
+	elapsed := time.Since(start)
+	addOllamaTime(ctx, elapsed)
+	recordOllamaLatency(elapsed)
+	if !errors.Is(err, context.Canceled) {
+		ollamaHealth.record(err == nil)
+		backends.record(base, err == nil)
+	}
+	return chatResp, err
+}
+
+// postChat performs the HTTP exchange for sendChat against the Ollama instance at base.
+// Ollama versions without /api/chat answer it with a plain 404; those backends are served
+// through /api/generate instead (see postGenerate) unless OLLAMA_GENERATE_FALLBACK=false.
+func postChat(ctx context.Context, base *url.URL, chatReq ChatRequest) (*ChatResponse, error) {
+	if chatUnsupported(base) {
+		return postGenerate(ctx, base, chatReq)
+	}
+	status, contentType, body, err := postOllama(ctx, base.JoinPath("/api/chat").String(), chatReq)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound && !strings.Contains(contentType, "json") && os.Getenv("OLLAMA_GENERATE_FALLBACK") != "false" {
+		markChatUnsupported(base)
+		return postGenerate(ctx, base, chatReq)
+	}
+	if err := checkOllamaBody(status, contentType, body); err != nil {
+		return nil, err
+	}
 
 	var chatResp ChatResponse
 	if err := json.Unmarshal(body, &chatResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal Ollama response: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal Ollama response (status %d): %w", status, err)
+	}
+	if status != http.StatusOK || chatResp.Error != "" {
+		return nil, &ollamaError{StatusCode: status, Message: chatResp.Error}
 	}
+	chatResp.Raw = body
 
-	return chatResp.Message.Content, nil
+	return &chatResp, nil
+}
+
+// postOllama POSTs payload as JSON to endpoint and returns the response status, content
+// type and body. Only transport failures are errors; the caller judges the response.
+func postOllama(ctx context.Context, endpoint string, payload interface{}) (int, string, []byte, error) {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to marshal chat request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to build Ollama request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("HTTP POST to Ollama failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to read Ollama response body: %w", err)
+	}
+
+	log.Printf("Ollama raw response: %s", truncate(string(body), envInt("OLLAMA_LOG_BODY_LIMIT", 2048)))
+	return resp.StatusCode, resp.Header.Get("Content-Type"), body, nil
+}
+
+// checkOllamaBody rejects responses that can't be decoded as JSON.
+// Proxies in front of Ollama may answer errors with HTML or nothing at all.
+func checkOllamaBody(status int, contentType string, body []byte) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return &ollamaError{StatusCode: status, Message: "empty response body"}
+	}
+	if !strings.Contains(contentType, "json") {
+		return &ollamaError{
+			StatusCode: status,
+			Message:    fmt.Sprintf("unexpected %q response: %s", contentType, truncate(string(body), 200)),
+		}
+	}
+	return nil
+}
+
+// truncate shortens s to at most limit bytes, marking the cut. A limit of zero or less disables truncation.
+func truncate(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	return s[:limit] + fmt.Sprintf("... (%d bytes truncated)", len(s)-limit)
+}
+
+// warmUp sends a trivial chat request for the default model so Ollama loads it
+// before the first real request arrives. Failures are logged, never fatal.
+func warmUp(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	model := defaultModel()
+	start := time.Now()
+	_, err := sendChat(ctx, ChatRequest{
+		Model:    model,
+		Messages: []ChatMessage{{Role: "user", Content: "Hello"}},
+		Stream:   false,
+	})
+	if err != nil {
+		log.Printf("Warm-up of model %s failed: %v", model, err)
+		return
+	}
+	log.Printf("Warm-up of model %s completed in %s", model, time.Since(start).Round(time.Millisecond))
+}
+
+// promptInput bundles everything buildPrompt needs to describe the request to the model.
+type promptInput struct {
+	Location    string
+	Query       string
+	Units       string   // distance units for display, "mi" or "km"
+	Features    []string // features the user asked for, mentioned for each restaurant
+	Meal        string   // "breakfast", "lunch" or "dinner"
+	Weather     string   // current weather at the location, when INCLUDE_WEATHER is on
+	Restaurants []Restaurant
+	Featured    *Restaurant // optional restaurant the model should highlight
+	NoDistance  bool        // distances are unknown (geocoding disabled), so leave them out
+	Sections    []string    // headings the reply must use, from REQUIRED_SECTIONS
+	Language    string      // reply language tag, e.g. "de"; empty leaves it to the model
+	Summary     bool        // ask for a single short sentence
+	Surprise    bool        // Featured is a random "surprise me" pick to present on its own
+	Prefer      string      // near-tie preference, a key of preferInstructions
+
+	AskAlternatives bool // ask the model to end with a parseable "Alternatives:" section
+	AskStructured   bool // ask the model to answer with a JSON Recommendation
+}
+
+// buildPrompt builds the restaurant summary prompt sent to the model.
+func buildPrompt(in promptInput) string {
+	prompt := "User is looking for restaurants"
+	if in.Meal != "" {
+		prompt += " for " + in.Meal
+	}
+	prompt += fmt.Sprintf(" near %s", in.Location)
+	if in.Query != "" {
+		prompt += fmt.Sprintf(" with query '%s'.", in.Query)
+	} else {
+		prompt += "."
+	}
+	if in.Weather != "" {
+		prompt += fmt.Sprintf("\nCurrent weather there: %s.", in.Weather)
+	}
+	prompt += "\nHere are some options:\n"
+	for _, r := range in.Restaurants {
+		prompt += restaurantLine(r, in)
+	}
+	if in.Surprise {
+		prompt += fmt.Sprintf("\nThe user asked to be surprised: enthusiastically present %s as a single pick.", in.Featured.Name)
+	} else if in.Featured != nil {
+		prompt += fmt.Sprintf("\nFeature %s as the main pick, mentioning the others as alternatives.", in.Featured.Name)
+	}
+	prompt += "\nPlease provide a friendly recommendation based on the above options."
+	if in.Prefer != "" {
+		prompt += "\n" + preferInstructions[in.Prefer]
+	}
+	if in.Summary && !in.AskStructured {
+		prompt += fmt.Sprintf("\nAnswer in a single short sentence of at most %d characters.", envInt("SUMMARY_MAX_LENGTH", summaryMaxLength))
+	} else if len(in.Sections) > 0 && !in.AskStructured {
+		prompt += sectionsInstruction(in.Sections)
+	}
+	if in.Language != "" {
+		prompt += fmt.Sprintf("\nRespond in %s.", languageName(in.Language))
+	}
+	if in.AskStructured {
+		prompt += structuredInstruction
+	} else if in.AskAlternatives {
+		prompt += alternativesInstruction
+	}
+	return prompt
+}
+
+// restaurantLine renders one restaurant's entry in the prompt.
+func restaurantLine(r Restaurant, in promptInput) string {
+	line := fmt.Sprintf("- %s at %s, Price: $%.2f, Rating: %.1f", r.Name, r.Address, r.Price, r.Rating)
+	if in.NoDistance {
+		line += "."
+	} else {
+		line += fmt.Sprintf(", Distance: %s.", formatDistance(r.Distance, in.Units))
+	}
+	if r.WaitMinutes != nil {
+		line += fmt.Sprintf(" Typical wait right now: %d min.", *r.WaitMinutes)
+	}
+	if r.ClosesInMinutes != nil {
+		line += fmt.Sprintf(" Closing soon: closes in %d min.", *r.ClosesInMinutes)
+	}
+	if r.Pinned {
+		line += " Pinned by the user: be sure to consider it."
+	}
+	if len(in.Features) > 0 && hasAllFeatures(r, in.Features) {
+		line += fmt.Sprintf(" Has requested features: %s.", strings.Join(in.Features, ", "))
+	}
+	if r.Sentiment != nil {
+		line += fmt.Sprintf(" Review sentiment: %s.\n", sentimentSummary(*r.Sentiment, len(r.Reviews)))
+	} else {
+		line += fmt.Sprintf(" Recent reviews: %s\n", formatReviews(r.Reviews, envInt("PROMPT_REVIEWS_PER_RESTAURANT", 3)))
+	}
+	return line
+}
+
+// singleMatchContent is the deterministic recommendation used when only r matched,
+// in place of a model reply.
+func singleMatchContent(r Restaurant, in promptInput) string {
+	content := fmt.Sprintf("%s is the one place that matches: %s at %s, rated %.1f, about $%.0f",
+		r.Name, cuisineOrRestaurant(r), r.Address, r.Rating, r.Price)
+	if !in.NoDistance {
+		content += fmt.Sprintf(", %s away", formatDistance(r.Distance, in.Units))
+	}
+	return content + "."
+}
+
+// cuisineOrRestaurant describes r by its cuisine when known, e.g. "an italian restaurant".
+func cuisineOrRestaurant(r Restaurant) string {
+	if r.Cuisine == "" {
+		return "a restaurant"
+	}
+	article := "a"
+	if strings.ContainsRune("aeiou", rune(r.Cuisine[0])) {
+		article = "an"
+	}
+	return fmt.Sprintf("%s %s restaurant", article, r.Cuisine)
+}
+
+// hashUser returns a short, stable hash of an end-user identifier so it can be logged
+// and correlated without recording the raw value.
+func hashUser(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return hex.EncodeToString(sum[:8])
 }
 
 // handleRequest processes the incoming HTTP request, builds a restaurant summary prompt,
 // calls the Ollama backend for a tailored recommendation, and returns an OpenAI-compatible response.
 func handleRequest(w http.ResponseWriter, r *http.Request) {
 	var reqData RequestBody
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var err error
+	if isMultipart(r) {
+		reqData, err = decodeMultipartRequest(r)
+	} else {
+		reqData, err = decodeRequest(r.Body)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkMetadata(reqData.Metadata); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkLanguages(reqData.Languages); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkPrefer(reqData.Prefer); err != nil {
+		writeError(w, err)
+		return
+	}
+	// Enforce the length limits before any field leaves the server for the webhook.
+	if err := checkFieldLengths(reqData); err != nil {
+		writeError(w, err)
 		return
 	}
+	if err := validateRequest(r.Context(), reqData, r.RemoteAddr); err != nil {
+		writeError(w, err)
+		return
+	}
+	found, err := findCandidates(r.Context(), reqData)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	meal, err := resolveMeal(reqData.Meal, found.Location)
+	if err != nil {
+		writeError(w, badRequest(err.Error()))
+		return
+	}
+	area, filters, residualQuery, restaurants := found.Area, found.Filters, found.Query, found.Restaurants
+	if reqData.User != "" {
+		log.Printf("Chat request for %q from user %s", area.Name, hashUser(reqData.User))
+	} else {
+		log.Printf("Chat request for %q", area.Name)
+	}
 
-	restaurants, err := getRestaurants(reqData.Location)
+	in := promptInput{
+		Location:    area.Name,
+		Query:       residualQuery,
+		Units:       reqData.Units,
+		Features:    filters.Features,
+		Meal:        meal,
+		Restaurants: restaurants,
+		NoDistance:  !geocodingEnabled(),
+		Sections:    requiredSections(),
+		Language:    resolveLanguage(reqData.Language, r),
+		Summary:     reqData.Summary,
+		Prefer:      reqData.Prefer,
+
+		AskAlternatives: reqData.Alternatives,
+		AskStructured:   reqData.Structured,
+	}
+	if len(reqData.Languages) > 0 {
+		in.Language = reqData.Languages[0]
+	}
+	warnings := found.Warnings
+
+	// The prompt is filled in once the candidates are enriched below; everything else about
+	// the request is settled now, so invalid options fail before any outbound call.
+	chatReq, err := buildChatRequest(reqData, "")
 	if err != nil {
-		http.Error(w, "Error fetching restaurant data", http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+	if len(reqData.Images) > 0 && !visionModel(chatReq.Model) {
+		warnings = append(warnings, fmt.Sprintf("image ignored: model %s does not support images", chatReq.Model))
+	}
+	steps, err := postProcessSteps(reqData)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	buildResponse, err := responseBuilder(reqData.ResponseStyle)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	// Build the prompt by incorporating the location, query, and restaurant details.
-	prompt := fmt.Sprintf("User is looking for restaurants near %s", reqData.Location)
-	if reqData.Query != "" {
-		prompt += fmt.Sprintf(" with query '%s'.", reqData.Query)
-	} else {
-		prompt += "."
+	// With a single candidate there is nothing for the model to choose between. This counts
+	// the matches before the token budget trimmed them, so a trimmed list never qualifies,
+	// and a lone pinned place that fails the filters is left to the model to present. The
+	// templated reply is English, so other languages go to the model too. It runs before
+	// the enrichment steps, which may call the model themselves.
+	if len(found.Restaurants) == 1 && !found.Restaurants[0].Unmatched && !reqData.Surprise && !reqData.AlwaysUseAI && !reqData.DryRun && len(reqData.Tools) == 0 && len(reqData.Languages) <= 1 && englishReply(in.Language) {
+		only := found.Restaurants[0]
+		content := applyPostProcess(singleMatchContent(only, in), steps)
+		res := chatResult{
+			Model:        chatReq.Model,
+			Content:      content,
+			FinishReason: "single_match",
+			Restaurants:  found.Restaurants,
+			Alternatives: []Alternative{},
+			WantAlts:     reqData.Alternatives,
+			Warnings:     warnings,
+			Metadata:     reqData.Metadata,
+
+			AppliedFilters: found.appliedFilters(),
+			DataAge:        found.dataAge(),
+			Nearest:        nearestRestaurant(found.Restaurants),
+		}
+		if reqData.Structured {
+			res.Recommendation = &Recommendation{Name: only.Name, Reason: content, Confidence: 5}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildResponse(res))
+		return
 	}
-	prompt += "\nHere are some options:\n"
-	for _, r := range restaurants {
-		prompt += fmt.Sprintf("- %s at %s, Price: $%.2f, Rating: %.1f, Distance: %.1f miles. Reviews: %v\n",
-			r.Name, r.Address, r.Price, r.Rating, r.Distance, r.Reviews)
+
+	// A cached reply is served before the enrichment steps, which may call out for weather
+	// and sentiment. Dry runs always describe a fresh request.
+	var cacheKey string
+	if !reqData.DryRun {
+		cacheKey = responseCacheKey(reqData, chatReq, in)
+	}
+	if cacheKey != "" {
+		if body, ok := responses.get(cacheKey); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Cache", "HIT")
+			w.Header().Add("Vary", "Accept-Language")
+			w.Write(body)
+			return
+		}
+	}
+
+	if envBool("INCLUDE_WEATHER") {
+		weather, err := currentWeather(r.Context(), area)
+		if err != nil {
+			log.Printf("Weather lookup for %q failed: %v", area.Name, err)
+			warnings = append(warnings, "current weather unavailable")
+		}
+		in.Weather = weather
+	}
+	dropSharedReviews(in.Restaurants, envInt("REVIEW_DEDUP_THRESHOLD", 0))
+	// A dry run promises not to generate, so it scores sentiment without the model.
+	annotateSentiment(r.Context(), in.Restaurants, !reqData.DryRun)
+	if budget := envInt("PROMPT_TOKEN_BUDGET", 0); budget > 0 {
+		in.Restaurants = fitTokenBudget(in, budget, envInt("PROMPT_TOKEN_HEADROOM", 200))
+	}
+
+	if reqData.Surprise {
+		if pick, ok := pickSurprise(in.Restaurants, now().In(found.Location), newRNG(reqData.Seed)); ok {
+			in.Restaurants = []Restaurant{pick}
+			in.Featured = &pick
+			in.Surprise = true
+		} else {
+			warnings = append(warnings, "no open, well-rated restaurant to surprise you with")
+		}
+	} else if reqData.Variety {
+		if pick, ok := pickFeatured(in.Restaurants, found.Weights, newRNG(reqData.Seed)); ok {
+			in.Featured = &pick
+		}
+	}
+
+	// The prompt is always the last message (see buildChatRequest).
+	chatReq.Messages[len(chatReq.Messages)-1].Content = buildPrompt(in)
+
+	if reqData.DryRun {
+		writeDryRun(w, chatReq)
+		return
+	}
+
+	// Further languages are generated alongside the primary reply.
+	var waitVariants func() (map[string]string, []string)
+	if len(reqData.Languages) > 1 {
+		waitVariants = generateVariants(r.Context(), reqData, in, reqData.Languages[1:], func(raw string) string {
+			text, _ := splitReasoning(raw)
+			if reqData.Alternatives {
+				text, _ = parseAlternatives(text)
+			}
+			if reqData.Structured {
+				if rec, ok := parseRecommendation(text, in.Restaurants); ok {
+					text = recommendationText(rec)
+				}
+			}
+			return applyPostProcess(text, steps) // screened with the rest by screenResult
+		})
+	}
+
+	chatResp, model, err := callOllama(r.Context(), chatReq)
+	if err != nil {
+		if waitVariants != nil {
+			waitVariants()
+		}
+		writeError(w, &httpError{Status: http.StatusInternalServerError, Message: "Error generating AI response", Err: err})
+		return
+	}
+
+	content, reasoning := splitReasoning(chatResp.Message.Content)
+	var alternatives []Alternative
+	if reqData.Alternatives {
+		content, alternatives = parseAlternatives(content)
+		if alternatives == nil {
+			alternatives = computeAlternatives(in.Restaurants, content, reqData.Units)
+		}
+	}
+	if !reqData.Structured {
+		for _, section := range missingSections(content, in.Sections) {
+			log.Printf("Reply is missing required section %q", section)
+			warnings = append(warnings, fmt.Sprintf("response is missing section %q", section))
+		}
+	}
+	var recommendation *Recommendation
+	if reqData.Structured {
+		if rec, ok := parseRecommendation(content, in.Restaurants); ok {
+			recommendation = &rec
+			content = recommendationText(rec)
+		}
+	}
+	content = applyPostProcess(content, steps)
+	// A summary must stay a single capped sentence, so there the flag alone reports it.
+	low := recommendation != nil && lowConfidence(*recommendation)
+	if low && !reqData.Summary {
+		content += "\n\n" + refineNote
 	}
-	prompt += "\nPlease provide a friendly recommendation based on the above options."
 
-	aiOutput, err := callOllama(prompt)
+	var translations map[string]string
+	if waitVariants != nil {
+		var failed []string
+		translations, failed = waitVariants()
+		translations[in.Language] = content
+		warnings = append(warnings, failed...)
+	}
+
+	res := chatResult{
+		Model:        model,
+		Content:      content,
+		ToolCalls:    chatResp.Message.ToolCalls,
+		Restaurants:  shuffleRestaurants(in.Restaurants, reqData.ShuffleSeed),
+		Alternatives: alternatives,
+		WantAlts:     reqData.Alternatives,
+		Warnings:     warnings,
+
+		Recommendation: recommendation,
+		LowConfidence:  low,
+		Metadata:       reqData.Metadata,
+		AppliedFilters: found.appliedFilters(),
+		DataAge:        found.dataAge(),
+		Translations:   translations,
+		Suggestion:     found.Suggestion,
+		Nearest:        nearestRestaurant(found.Restaurants),
+	}
+	if reqData.IncludeReasoning {
+		res.Reasoning = reasoning
+	}
+	if reqData.Debug && envBool("DEBUG_ENDPOINTS") {
+		res.RawOllama = truncate(string(chatResp.Raw), envInt("DEBUG_RAW_LIMIT", 4096))
+	}
+	screenResult(&res)
+
+	body, err := json.Marshal(buildResponse(res))
 	if err != nil {
-		log.Printf("callOllama error: %v", err)
-		http.Error(w, "Error generating AI response", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
+	body = append(body, '\n')
+	if cacheKey != "" {
+		responses.set(cacheKey, area.key(), body, envDuration("RESPONSE_CACHE_TTL", 0))
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Language")
+	w.Write(body)
+}
 
-	// Format the final response to mimic OpenAI's chat completion format.
+// writeDryRun reports the estimated prompt size of chatReq without calling the model.
+// The rendered messages are only included when DEBUG_ENDPOINTS=true, since they may
+// reveal system prompts.
+func writeDryRun(w http.ResponseWriter, chatReq ChatRequest) {
 	response := map[string]interface{}{
-		"id":      "chatcmpl-" + strconv.FormatInt(time.Now().UnixNano(), 10),
-		"object":  "chat.completion",
-		"created": time.Now().Unix(),
-		"choices": []map[string]interface{}{
-			{
-				"index":         0,
-				"message":       map[string]string{"role": "assistant", "content": aiOutput},
-				"finish_reason": "stop",
-			},
-		},
+		"object":                  "chat.completion.dry_run",
+		"model":                   chatReq.Model,
+		"estimated_prompt_tokens": estimateChatTokens(chatReq),
+	}
+	if envBool("DEBUG_ENDPOINTS") {
+		response["messages"] = chatReq.Messages
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -171,8 +953,70 @@ func handleRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	http.HandleFunc("/v1/chat/completions", handleRequest)
+	// Fail fast on misconfiguration rather than on the first request.
+	if err := selfCheck(); err != nil {
+		log.Fatalf("Startup self-check failed: %v", err)
+	}
+
+	if path := os.Getenv("ACCESS_LOG_FILE"); path != "" {
+		rf, err := openRotatingFile(path, int64(envInt("ACCESS_LOG_MAX_SIZE", 10<<20)), envInt("ACCESS_LOG_BACKUPS", 3))
+		if err != nil {
+			log.Fatalf("Opening access log: %v", err)
+		}
+		accessLog = rf
+	}
+
+	http.Handle("/v1/chat/completions", warmupMiddleware(debounceMiddleware(http.HandlerFunc(handleRequest))))
+	http.HandleFunc("/v1/restaurants", handleRestaurants)
+	http.HandleFunc("/status", handleStatus)
+	http.HandleFunc("/stats", handleStats)
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+	http.HandleFunc("/admin/cache/flush", handleCacheFlush)
 	port := "8080"
-	log.Printf("Server is running on port %s...", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Server %s (commit %s, built %s) is running on port %s...", version, commit, buildTime, port)
+
+	// Warm up in the background so a slow model load never delays serving. Until it
+	// finishes, successfully or not, chat requests and /readyz get 503 with Retry-After.
+	if envBool("WARMUP") {
+		warming.Store(true)
+		go func() {
+			defer warming.Store(false)
+			warmUp(envDuration("WARMUP_TIMEOUT", 2*time.Minute))
+		}()
+	}
+
+	handler := gzipMiddleware(http.DefaultServeMux)
+	handler = retryBudgetMiddleware(handler)
+	handler = loggingMiddleware(handler)
+	handler = statsMiddleware(handler)
+	handler = versionMiddleware(handler)
+	srv := &http.Server{Handler: handler}
+
+	// Shut down gracefully on SIGINT/SIGTERM so in-flight requests finish and the access log is flushed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	log.Printf("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 10*time.Second))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+	if accessLog != nil {
+		if err := accessLog.Close(); err != nil {
+			log.Printf("Closing access log: %v", err)
+		}
+	}
 }
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ollamaStub is a fake Ollama server that records the chat requests it receives.
+type ollamaStub struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []ChatRequest
+}
+
+// newOllamaStub starts an ollamaStub whose /api/chat is answered by handle and points
+// OLLAMA_URL at it for the rest of the test.
+func newOllamaStub(t *testing.T, handle func(w http.ResponseWriter, req ChatRequest)) *ollamaStub {
+	t.Helper()
+	s := &ollamaStub{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		var req ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+		handle(w, req)
+	}))
+	t.Cleanup(s.Close)
+	t.Setenv("OLLAMA_URL", s.URL)
+	return s
+}
+
+// received returns the chat requests the stub has seen so far.
+func (s *ollamaStub) received() []ChatRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ChatRequest(nil), s.requests...)
+}
+
+// reply answers every chat request with content.
+func reply(content string) func(http.ResponseWriter, ChatRequest) {
+	return func(w http.ResponseWriter, req ChatRequest) {
+		writeChatReply(w, req.Model, content)
+	}
+}
+
+// writeChatReply writes an Ollama chat reply from model carrying content.
+func writeChatReply(w http.ResponseWriter, model, content string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"model":   model,
+		"message": map[string]string{"role": "assistant", "content": content},
+		"done":    true,
+	})
+}
+
+// postChatCompletion sends body to handleRequest and returns the recorded response.
+func postChatCompletion(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleRequest(rec, req)
+	return rec
+}
+
+// decodeJSON decodes rec's body as a JSON object, failing the test when it isn't one.
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var out map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("response is not a JSON object (status %d): %v\n%s", rec.Code, err, rec.Body)
+	}
+	return out
+}
+
+// messageContent returns the assistant content of an OpenAI-style response.
+func messageContent(t *testing.T, resp map[string]interface{}) string {
+	t.Helper()
+	choices, _ := resp["choices"].([]interface{})
+	if len(choices) == 0 {
+		t.Fatalf("response has no choices: %v", resp)
+	}
+	message, _ := choices[0].(map[string]interface{})["message"].(map[string]interface{})
+	content, _ := message["content"].(string)
+	return content
+}
+
+func TestOllamaEndpoint(t *testing.T) {
+	tests := []struct {
+		name, raw, want string
+	}{
+		{"default", "", "http://localhost:11434/api/chat"},
+		{"bare host", "http://ollama:11434", "http://ollama:11434/api/chat"},
+		{"trailing slash", "http://ollama:11434/", "http://ollama:11434/api/chat"},
+		{"path prefix", "https://ai.example.com/ollama", "https://ai.example.com/ollama/api/chat"},
+		{"path prefix with slash", "https://ai.example.com/ollama/", "https://ai.example.com/ollama/api/chat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OLLAMA_URL", tt.raw)
+			got, err := ollamaEndpoint("/api/chat")
+			if err != nil {
+				t.Fatalf("ollamaEndpoint: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOllamaURLRejectsInvalidURLs(t *testing.T) {
+	for _, raw := range []string{"ollama:11434", "ftp://ollama:11434", "http://", "http://[::1", "://nope"} {
+		if _, err := parseOllamaURL(raw); err == nil {
+			t.Errorf("parseOllamaURL(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestWarmUpSendsChatForDefaultModel(t *testing.T) {
+	stub := newOllamaStub(t, reply("Hi!"))
+	t.Setenv("OLLAMA_MODEL", "warm-model")
+
+	warmUp(time.Second)
+
+	got := stub.received()
+	if len(got) != 1 {
+		t.Fatalf("Ollama received %d requests, want 1", len(got))
+	}
+	if got[0].Model != "warm-model" {
+		t.Errorf("warm-up used model %q, want warm-model", got[0].Model)
+	}
+	if len(got[0].Messages) != 1 || got[0].Messages[0].Role != "user" {
+		t.Errorf("warm-up sent messages %+v, want a single user message", got[0].Messages)
+	}
+}
+
+func TestWarmUpToleratesFailure(t *testing.T) {
+	stub := newOllamaStub(t, func(w http.ResponseWriter, req ChatRequest) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	warmUp(time.Second) // must return rather than panic or exit
+
+	if n := len(stub.received()); n != 1 {
+		t.Errorf("Ollama received %d requests, want 1", n)
+	}
+}
+
+func TestFormatAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Restaurant
+		want string
+	}{
+		{"full", Restaurant{Street: "123 Main St", City: "San Francisco", State: "CA", PostalCode: "94105", Country: "USA"}, "123 Main St, San Francisco, CA 94105, USA"},
+		{"no postal code", Restaurant{Street: "123 Main St", City: "San Francisco", State: "CA"}, "123 Main St, San Francisco, CA"},
+		{"postal code only in region", Restaurant{City: "Berlin", PostalCode: "10115", Country: "Germany"}, "Berlin, 10115, Germany"},
+		{"street only", Restaurant{Street: "456 Elm St"}, "456 Elm St"},
+		{"empty", Restaurant{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatAddress(tt.r); got != tt.want {
+				t.Errorf("formatAddress = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// notFound answers a chat request the way Ollama does for a model it doesn't have.
+func notFound(w http.ResponseWriter, req ChatRequest) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("model %q not found, try pulling it first", req.Model)})
+}
+
+func TestCallOllamaFallsBackToSmallerModel(t *testing.T) {
+	stub := newOllamaStub(t, func(w http.ResponseWriter, req ChatRequest) {
+		if req.Model == "big" {
+			notFound(w, req)
+			return
+		}
+		writeChatReply(w, req.Model, "Try Fancy Eats.")
+	})
+	t.Setenv("FALLBACK_MODEL", "small")
+
+	chatResp, model, err := callOllama(context.Background(), ChatRequest{Model: "big"})
+	if err != nil {
+		t.Fatalf("callOllama: %v", err)
+	}
+	if model != "small" {
+		t.Errorf("reported model %q, want small", model)
+	}
+	if chatResp.Message.Content != "Try Fancy Eats." {
+		t.Errorf("content = %q, want the fallback's reply", chatResp.Message.Content)
+	}
+	if got := stub.received(); len(got) != 2 || got[0].Model != "big" || got[1].Model != "small" {
+		t.Errorf("Ollama received %+v, want big then small", got)
+	}
+}
+
+func TestCallOllamaReportsBothFailures(t *testing.T) {
+	stub := newOllamaStub(t, notFound)
+	t.Setenv("FALLBACK_MODEL", "small")
+
+	_, _, err := callOllama(context.Background(), ChatRequest{Model: "big"})
+	if err == nil {
+		t.Fatal("callOllama succeeded, want an error")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "fallback model small failed") || !strings.Contains(msg, `"big" not found`) {
+		t.Errorf("error %q should name the fallback and the primary failure", msg)
+	}
+	if n := len(stub.received()); n != 2 {
+		t.Errorf("Ollama received %d requests, want 2", n)
+	}
+}
+
+func TestCallOllamaKeepsOtherErrors(t *testing.T) {
+	stub := newOllamaStub(t, func(w http.ResponseWriter, req ChatRequest) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": "unexpected EOF"}`))
+	})
+	t.Setenv("FALLBACK_MODEL", "small")
+
+	if _, _, err := callOllama(context.Background(), ChatRequest{Model: "big"}); err == nil {
+		t.Fatal("callOllama succeeded, want an error")
+	}
+	if n := len(stub.received()); n != 1 {
+		t.Errorf("Ollama received %d requests, want no fallback attempt", n)
+	}
+}
+
+func TestRestaurantLineMentionsWait(t *testing.T) {
+	withWait := restaurantLine(Restaurant{Name: "Budget Bites", WaitMinutes: intPtr(5)}, promptInput{})
+	if !strings.Contains(withWait, "Typical wait right now: 5 min.") {
+		t.Errorf("line does not mention the wait: %q", withWait)
+	}
+	if unknown := restaurantLine(Restaurant{Name: "Fancy Eats"}, promptInput{}); strings.Contains(unknown, "wait") {
+		t.Errorf("line mentions a wait that is unknown: %q", unknown)
+	}
+}
+
+func TestUserFieldIsLoggedHashed(t *testing.T) {
+	newOllamaStub(t, reply("Try Fancy Eats."))
+	logs := captureLogs(t)
+
+	reqData, err := decodeRequest(strings.NewReader(`{"location": "San Francisco", "user": "alice@example.com"}`))
+	if err != nil {
+		t.Fatalf("decodeRequest: %v", err)
+	}
+	if reqData.User != "alice@example.com" {
+		t.Errorf("user = %q, want it parsed", reqData.User)
+	}
+
+	if rec := postChatCompletion(t, `{"location": "San Francisco", "user": "alice@example.com"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(logs.String(), "alice@example.com") {
+		t.Error("the raw user identifier was logged")
+	}
+	if !strings.Contains(logs.String(), "from user "+hashUser("alice@example.com")) {
+		t.Errorf("logs lack the hashed user:\n%s", logs.String())
+	}
+}
+
+func TestHashUserIsStable(t *testing.T) {
+	if hashUser("alice") != hashUser("alice") {
+		t.Error("hashUser is not deterministic")
+	}
+	if hashUser("alice") == hashUser("bob") {
+		t.Error("different users hash alike")
+	}
+	if got := len(hashUser("alice")); got != 16 {
+		t.Errorf("hash has %d characters, want 16", got)
+	}
+}
+
+func TestBuildPromptShowsRequestedUnits(t *testing.T) {
+	restaurants := []Restaurant{{Name: "Budget Bites", Distance: 0.8}}
+	if km := buildPrompt(promptInput{Location: "Town", Units: "km", Restaurants: restaurants}); !strings.Contains(km, "Distance: 1.3 km.") {
+		t.Errorf("km prompt lacks the converted distance:\n%s", km)
+	}
+	if mi := buildPrompt(promptInput{Location: "Town", Restaurants: restaurants}); !strings.Contains(mi, "Distance: 0.8 miles.") {
+		t.Errorf("default prompt lacks the distance in miles:\n%s", mi)
+	}
+}
+
+func TestRestaurantLineMentionsMatchedFeatures(t *testing.T) {
+	in := promptInput{Features: []string{"delivery"}}
+	if line := restaurantLine(Restaurant{Name: "Courier", Features: []string{"delivery"}}, in); !strings.Contains(line, "Has requested features: delivery.") {
+		t.Errorf("line does not mention the matched feature: %q", line)
+	}
+	if line := restaurantLine(Restaurant{Name: "Courier", Features: []string{"delivery"}}, promptInput{}); strings.Contains(line, "features") {
+		t.Errorf("line mentions features nobody asked for: %q", line)
+	}
+}
+
+func TestRawOllamaOptions(t *testing.T) {
+	temperature := 0.4
+	reqData := RequestBody{
+		Temperature:   &temperature,
+		OllamaOptions: map[string]interface{}{"temperature": 0.9, "top_k": 20.0},
+	}
+
+	chatReq, err := buildChatRequest(reqData, "prompt")
+	if err != nil {
+		t.Fatalf("buildChatRequest: %v", err)
+	}
+	if chatReq.Options["temperature"] != 0.4 || chatReq.Options["top_k"] != nil {
+		t.Errorf("options = %v, want raw options ignored without ALLOW_RAW_OPTIONS", chatReq.Options)
+	}
+
+	t.Setenv("ALLOW_RAW_OPTIONS", "true")
+	chatReq, err = buildChatRequest(reqData, "prompt")
+	if err != nil {
+		t.Fatalf("buildChatRequest: %v", err)
+	}
+	if chatReq.Options["temperature"] != 0.9 || chatReq.Options["top_k"] != 20.0 {
+		t.Errorf("options = %v, want the raw options merged over the mapped ones", chatReq.Options)
+	}
+}
+
+func TestNonJSONOllamaResponse(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("Bad Gateway ", 100) + "</body></html>"
+	newOllamaStub(t, func(w http.ResponseWriter, req ChatRequest) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(page))
+	})
+	t.Setenv("OLLAMA_LOG_BODY_LIMIT", "40")
+	logs := captureLogs(t)
+
+	_, err := sendChat(context.Background(), ChatRequest{Model: "m"})
+	var oe *ollamaError
+	if !errors.As(err, &oe) || oe.StatusCode != http.StatusBadGateway {
+		t.Fatalf("err = %v, want an ollamaError with status 502", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "status 502") || !strings.Contains(msg, `unexpected "text/html" response`) {
+		t.Errorf("error %q should name the status and content type", msg)
+	}
+	if strings.Contains(logs.String(), "</html>") || !strings.Contains(logs.String(), "bytes truncated") {
+		t.Errorf("logged body was not truncated:\n%s", logs)
+	}
+}
+
+func TestEmptyOllamaResponse(t *testing.T) {
+	newOllamaStub(t, func(w http.ResponseWriter, req ChatRequest) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	_, err := sendChat(context.Background(), ChatRequest{Model: "m"})
+	if err == nil || !strings.Contains(err.Error(), "status 503: empty response body") {
+		t.Errorf("err = %v, want an empty body error with the status", err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("abcdefgh", 3); got != "abc... (5 bytes truncated)" {
+		t.Errorf("truncate = %q", got)
+	}
+	for _, limit := range []int{0, -1, 8, 100} {
+		if got := truncate("abcdefgh", limit); got != "abcdefgh" {
+			t.Errorf("truncate with limit %d = %q, want it unchanged", limit, got)
+		}
+	}
+}
+
+func TestSingleMatchSkipsOllama(t *testing.T) {
+	stub := newOllamaStub(t, reply("The model's pick."))
+	rec := postChatCompletion(t, `{"location": "San Francisco", "query": "cheap food"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	resp := decodeJSON(t, rec)
+	choice := resp["choices"].([]interface{})[0].(map[string]interface{})
+	if choice["finish_reason"] != "single_match" {
+		t.Errorf("finish_reason = %v, want single_match", choice["finish_reason"])
+	}
+	if got := messageContent(t, resp); !strings.HasPrefix(got, "Budget Bites is the one place that matches") {
+		t.Errorf("content = %q", got)
+	}
+	if n := len(stub.received()); n != 0 {
+		t.Errorf("Ollama called %d times for a single match", n)
+	}
+}
+
+func TestSingleMatchInOtherLanguagesUsesOllama(t *testing.T) {
+	tests := []struct {
+		name, language, header, fallback string
+	}{
+		{name: "field", language: "fr"},
+		{name: "header", header: "de-DE"},
+		{name: "default", fallback: "es"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEFAULT_LANGUAGE", tt.fallback)
+			stub := newOllamaStub(t, reply("Le choix du modèle."))
+			body := fmt.Sprintf(`{"location": "San Francisco", "query": "cheap food", "language": %q}`, tt.language)
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", tt.header)
+			rec := httptest.NewRecorder()
+			handleRequest(rec, req)
+			if got := messageContent(t, decodeJSON(t, rec)); got != "Le choix du modèle." {
+				t.Errorf("content = %q, want the model's reply", got)
+			}
+			if n := len(stub.received()); n != 1 {
+				t.Errorf("Ollama called %d times, want 1", n)
+			}
+		})
+	}
+
+	t.Setenv("DEFAULT_LANGUAGE", "en-GB")
+	stub := newOllamaStub(t, reply("The model's pick."))
+	postChatCompletion(t, `{"location": "San Francisco", "query": "cheap food"}`)
+	if n := len(stub.received()); n != 0 {
+		t.Errorf("Ollama called %d times for an English single match", n)
+	}
+}
+
+func TestAlwaysUseAIForcesOllama(t *testing.T) {
+	stub := newOllamaStub(t, reply("The model's pick."))
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco", "query": "cheap food", "always_use_ai": true}`))
+	if got := messageContent(t, resp); got != "The model's pick." {
+		t.Errorf("content = %q, want the model's reply", got)
+	}
+	if n := len(stub.received()); n != 1 {
+		t.Errorf("Ollama called %d times, want 1", n)
+	}
+}
+
+func TestDebugRawOllamaNeedsBothGates(t *testing.T) {
+	newOllamaStub(t, reply("Try Fancy Eats."))
+	rawOllama := func(body string) interface{} {
+		t.Helper()
+		resp := decodeJSON(t, postChatCompletion(t, body))
+		debug, _ := resp["debug"].(map[string]interface{})
+		return debug["raw_ollama"]
+	}
+
+	if raw := rawOllama(`{"location": "San Francisco", "debug": true}`); raw != nil {
+		t.Errorf("raw reply exposed without DEBUG_ENDPOINTS: %v", raw)
+	}
+	t.Setenv("DEBUG_ENDPOINTS", "true")
+	if raw := rawOllama(`{"location": "San Francisco"}`); raw != nil {
+		t.Errorf("raw reply exposed without debug: %v", raw)
+	}
+	raw, _ := rawOllama(`{"location": "San Francisco", "debug": true}`).(string)
+	if !strings.Contains(raw, `"content":"Try Fancy Eats."`) {
+		t.Errorf("raw_ollama = %q, want the Ollama body", raw)
+	}
+
+	t.Setenv("DEBUG_RAW_LIMIT", "10")
+	raw, _ = rawOllama(`{"location": "San Francisco", "debug": true}`).(string)
+	if strings.Index(raw, "... (") != 10 || !strings.HasSuffix(raw, "bytes truncated)") {
+		t.Errorf("raw_ollama = %q, want it cut to 10 bytes", raw)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// now returns the current time. Tests replace it to control time-based behavior.
+var now = time.Now
+
+// mealAt infers the meal being planned from the local time of day.
+func mealAt(t time.Time) string {
+	switch h := t.Hour(); {
+	case h >= 5 && h < 11:
+		return "breakfast"
+	case h >= 11 && h < 16:
+		return "lunch"
+	default:
+		return "dinner"
+	}
+}
+
+// resolveMeal returns the meal a request is for: the explicit meal field
+// ("breakfast", "lunch" or "dinner") when set, otherwise one inferred from the current
+// time in loc, the search area's time zone.
+func resolveMeal(meal string, loc *time.Location) (string, error) {
+	if meal == "" {
+		return mealAt(now().In(loc)), nil
+	}
+	switch m := strings.ToLower(meal); m {
+	case "breakfast", "lunch", "dinner":
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown meal %q (want breakfast, lunch or dinner)", meal)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setClock makes now return t for the rest of the test.
+func setClock(t *testing.T, at time.Time) {
+	t.Helper()
+	old := now
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = old })
+}
+
+func TestResolveMealExplicit(t *testing.T) {
+	setClock(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+	for _, meal := range []string{"breakfast", "Lunch", "DINNER"} {
+		got, err := resolveMeal(meal, time.UTC)
+		if err != nil {
+			t.Fatalf("resolveMeal(%q): %v", meal, err)
+		}
+		if got != strings.ToLower(meal) {
+			t.Errorf("resolveMeal(%q) = %q, want the explicit meal whatever the time", meal, got)
+		}
+	}
+	if _, err := resolveMeal("brunch", time.UTC); err == nil {
+		t.Error("resolveMeal accepted an unknown meal")
+	}
+}
+
+func TestResolveMealFromClock(t *testing.T) {
+	tests := map[int]string{4: "dinner", 5: "breakfast", 10: "breakfast", 11: "lunch", 15: "lunch", 16: "dinner", 23: "dinner"}
+	for hour, want := range tests {
+		setClock(t, time.Date(2024, 5, 1, hour, 30, 0, 0, time.UTC))
+		if got, _ := resolveMeal("", time.UTC); got != want {
+			t.Errorf("at %02d:30 resolveMeal = %q, want %q", hour, got, want)
+		}
+	}
+}
+
+func TestResolveMealUsesLocalTime(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	setClock(t, time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)) // 08:00 in Tokyo
+	if got, _ := resolveMeal("", tokyo); got != "breakfast" {
+		t.Errorf("resolveMeal = %q, want breakfast in the area's time zone", got)
+	}
+}
+
+func TestBuildPromptIncludesMeal(t *testing.T) {
+	prompt := buildPrompt(promptInput{Location: "Town", Meal: "breakfast"})
+	if !strings.HasPrefix(prompt, "User is looking for restaurants for breakfast near Town") {
+		t.Errorf("prompt does not mention the meal:\n%s", prompt)
+	}
+}
+
+func TestUnknownMealIsRejected(t *testing.T) {
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	rec := postChatCompletion(t, `{"location": "San Francisco", "meal": "brunch"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `unknown meal "brunch"`) {
+		t.Errorf("status %d, body %q, want a 400 naming the meal", rec.Code, rec.Body)
+	}
+	if n := len(stub.received()); n != 0 {
+		t.Errorf("Ollama called %d times for a rejected request", n)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMiddleware compresses responses for clients that send Accept-Encoding: gzip.
+// Bodies smaller than GZIP_MIN_SIZE bytes (default 1024) and server-sent event streams
+// are passed through uncompressed so small replies stay cheap and SSE stays flushable.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, minSize: envInt("GZIP_MIN_SIZE", 1024)}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header value allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if q, err := strconv.ParseFloat(value, 64); key == "q" && err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether the body is
+// large enough to be worth compressing, then either gzips or passes everything through.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     []byte
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = status
+	if w.skipCompression() {
+		w.passthrough()
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if w.skipCompression() {
+			w.passthrough()
+		} else {
+			w.buf = append(w.buf, p...)
+			if len(w.buf) >= w.minSize {
+				if err := w.startGzip(); err != nil {
+					return 0, err
+				}
+			}
+			return len(p), nil
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends buffered data to the client. A response flushed before reaching the
+// size threshold is sent uncompressed, since the handler is evidently streaming.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.passthrough()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the response, sending any body still buffered below the threshold as-is.
+func (w *gzipResponseWriter) Close() error {
+	if !w.decided {
+		w.passthrough()
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// skipCompression reports whether the handler's headers rule out compression.
+func (w *gzipResponseWriter) skipCompression() bool {
+	h := w.Header()
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream") || h.Get("Content-Encoding") != ""
+}
+
+func (w *gzipResponseWriter) writeStatus() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *gzipResponseWriter) passthrough() {
+	w.decided = true
+	w.writeStatus()
+	if len(w.buf) > 0 {
+		w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *gzipResponseWriter) startGzip() error {
+	w.decided = true
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.writeStatus()
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf)
+	w.buf = nil
+	return err
+}
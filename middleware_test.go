@@ -0,0 +1,96 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveGzip runs handler behind gzipMiddleware for a request with the given Accept-Encoding.
+func serveGzip(handler http.HandlerFunc, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	gzipMiddleware(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGzipCompressesLargeJSON(t *testing.T) {
+	body := `{"restaurants": "` + strings.Repeat("Fancy Eats ", 200) + `"}`
+	rec := serveGzip(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}, "gzip, deflate")
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzip body: %v", err)
+	}
+	if string(plain) != body {
+		t.Error("decompressed body differs from the original")
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+}
+
+func TestGzipSkipsSmallBodies(t *testing.T) {
+	t.Setenv("GZIP_MIN_SIZE", "100")
+	rec := serveGzip(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"ok": true}`)
+	}, "gzip")
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q for a small body, want none", got)
+	}
+	if rec.Body.String() != `{"ok": true}` {
+		t.Errorf("body = %q, want it unchanged", rec.Body)
+	}
+}
+
+func TestGzipLeavesSSEUncompressed(t *testing.T) {
+	rec := serveGzip(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 100; i++ {
+			io.WriteString(w, "data: "+strings.Repeat("x", 50)+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+	}, "gzip")
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q for an event stream, want none", got)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "data: ") {
+		t.Errorf("event stream body was altered: %.40q", rec.Body)
+	}
+	if !rec.Flushed {
+		t.Error("event stream was never flushed to the client")
+	}
+}
+
+func TestGzipHonorsAcceptEncoding(t *testing.T) {
+	body := strings.Repeat("a", 4096)
+	for _, header := range []string{"", "deflate", "gzip;q=0"} {
+		rec := serveGzip(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		}, header)
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want none", header, got)
+		}
+		if rec.Body.Len() != len(body) {
+			t.Errorf("Accept-Encoding %q: body was altered", header)
+		}
+	}
+}
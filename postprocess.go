@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// postProcessor transforms the assistant's content before it is returned.
+type postProcessor func(string) string
+
+var (
+	mdHeading    = regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}[ \t]+`)
+	mdBullet     = regexp.MustCompile(`(?m)^[ \t]*[-*+][ \t]+`)
+	mdBold       = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	mdItalic     = regexp.MustCompile(`\*([^*\s][^*]*?)\*|\b_([^_\s][^_]*?)_\b`)
+	mdCode       = regexp.MustCompile("`([^`]*)`")
+	mdLink       = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// stripMarkdown removes common Markdown formatting (headings, bullets, emphasis, inline
+// code and links), leaving plain text.
+func stripMarkdown(s string) string {
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdCode.ReplaceAllString(s, "$1")
+	s = mdBold.ReplaceAllString(s, "$1$2")
+	s = mdItalic.ReplaceAllString(s, "$1$2")
+	s = mdHeading.ReplaceAllString(s, "")
+	s = mdBullet.ReplaceAllString(s, "")
+	s = mdBlankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
+
+// singleParagraph joins all lines into one paragraph.
+func singleParagraph(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// firstSentenceOnly keeps only the first sentence of s.
+func firstSentenceOnly(s string) string {
+	s = strings.TrimSpace(s)
+	for i, r := range s {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		// Only a terminator followed by whitespace (or the end) ends the sentence, so
+		// "$12.50" and "St. Louis"-style abbreviations mostly survive.
+		if rest := s[i+1:]; rest == "" || rest[0] == ' ' || rest[0] == '\n' {
+			return s[:i+1]
+		}
+	}
+	return s
+}
+
+// summaryMaxLength is the default character cap for summary replies (SUMMARY_MAX_LENGTH).
+const summaryMaxLength = 160
+
+// maxLength returns a processor that cuts s to at most limit characters, breaking at the
+// last word boundary and marking the cut with an ellipsis.
+func maxLength(limit int) postProcessor {
+	return func(s string) string {
+		if limit <= 0 || utf8.RuneCountInString(s) <= limit {
+			return s
+		}
+		runes := []rune(s)
+		cut := string(runes[:limit-1]) // leave room for the ellipsis
+		if i := strings.LastIndexAny(cut, " \n\t"); i > 0 {
+			cut = cut[:i]
+		}
+		return strings.TrimRight(cut, " \n\t,;:-") + "…"
+	}
+}
+
+// postProcessSteps returns the processing steps for a request: its postprocess field if
+// set, otherwise the comma-separated POSTPROCESS config. Supported steps are
+// "strip_markdown", "single_paragraph" and "max_length" (using the request's max_length
+// or MAX_RESPONSE_LENGTH). Steps run in the order given. Summary requests additionally
+// end with a cut to one sentence of at most SUMMARY_MAX_LENGTH characters.
+func postProcessSteps(reqData RequestBody) ([]postProcessor, error) {
+	names := reqData.PostProcess
+	if names == nil {
+		if raw := os.Getenv("POSTPROCESS"); raw != "" {
+			names = strings.Split(raw, ",")
+		}
+	}
+	limit := envInt("MAX_RESPONSE_LENGTH", 0)
+	if reqData.MaxLength > 0 {
+		limit = reqData.MaxLength
+	}
+
+	var steps []postProcessor
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "strip_markdown":
+			steps = append(steps, stripMarkdown)
+		case "single_paragraph":
+			steps = append(steps, singleParagraph)
+		case "max_length":
+			steps = append(steps, maxLength(limit))
+		case "":
+		default:
+			return nil, badRequest(fmt.Sprintf("unknown postprocess step %q", name))
+		}
+	}
+	// Summary mode always ends with a hard cap on a single sentence.
+	if reqData.Summary {
+		steps = append(steps, stripMarkdown, singleParagraph, firstSentenceOnly,
+			maxLength(envInt("SUMMARY_MAX_LENGTH", summaryMaxLength)))
+	}
+	return steps, nil
+}
+
+// applyPostProcess runs content through steps in order.
+func applyPostProcess(content string, steps []postProcessor) string {
+	for _, step := range steps {
+		content = step(content)
+	}
+	return content
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	in := "## Top picks\n\n- **Fancy Eats**: *elegant* French\n* Budget Bites, see [menu](http://example.com)\n+ `The Gourmet Spot`"
+	want := "Top picks\n\nFancy Eats: elegant French\nBudget Bites, see menu\nThe Gourmet Spot"
+	if got := stripMarkdown(in); got != want {
+		t.Errorf("stripMarkdown =\n%q\nwant\n%q", got, want)
+	}
+	if got := stripMarkdown("snake_case_name stays"); got != "snake_case_name stays" {
+		t.Errorf("stripMarkdown mangled underscores: %q", got)
+	}
+}
+
+func TestMaxLengthCutsAtWordBoundary(t *testing.T) {
+	cut := maxLength(20)("Fancy Eats is a wonderful French bistro.")
+	if cut != "Fancy Eats is a…" {
+		t.Errorf("maxLength(20) = %q", cut)
+	}
+	if n := utf8.RuneCountInString(cut); n > 20 {
+		t.Errorf("result has %d characters, over the limit", n)
+	}
+	if got := maxLength(100)("short"); got != "short" {
+		t.Errorf("maxLength cut a short string: %q", got)
+	}
+	if got := maxLength(6)("Café crème brûlée"); got != "Café…" {
+		t.Errorf("maxLength counted bytes rather than characters: %q", got)
+	}
+}
+
+func TestPostProcessPipeline(t *testing.T) {
+	steps, err := postProcessSteps(RequestBody{PostProcess: []string{"strip_markdown", "single_paragraph", "max_length"}, MaxLength: 30})
+	if err != nil {
+		t.Fatalf("postProcessSteps: %v", err)
+	}
+	got := applyPostProcess("# Picks\n\n- **Fancy Eats** for dinner\n- Budget Bites for lunch", steps)
+	if got != "Picks Fancy Eats for dinner…" {
+		t.Errorf("pipeline = %q", got)
+	}
+
+	t.Setenv("POSTPROCESS", "single_paragraph")
+	steps, _ = postProcessSteps(RequestBody{})
+	if got := applyPostProcess("a\n\nb", steps); got != "a b" {
+		t.Errorf("POSTPROCESS pipeline = %q, want a b", got)
+	}
+	if _, err := postProcessSteps(RequestBody{PostProcess: []string{"uppercase"}}); err == nil {
+		t.Error("postProcessSteps accepted an unknown step")
+	}
+}
+
+func TestSummaryIsOneSentenceUnderTheCap(t *testing.T) {
+	t.Setenv("SUMMARY_MAX_LENGTH", "60")
+	stub := newOllamaStub(t, reply("**Fancy Eats** is a lovely French spot with a wonderful tasting menu and attentive staff. Budget Bites is cheaper.\n\nEnjoy!"))
+	rec := postChatCompletion(t, `{"location": "San Francisco", "summary": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if prompt := stub.received()[0].Messages[0].Content; !strings.Contains(prompt, "single short sentence of at most 60 characters") {
+		t.Errorf("prompt lacks the summary instruction:\n%s", prompt)
+	}
+	got := messageContent(t, decodeJSON(t, rec))
+	if n := utf8.RuneCountInString(got); n > 60 {
+		t.Errorf("summary is %d characters: %q", n, got)
+	}
+	if !strings.HasPrefix(got, "Fancy Eats is a lovely French spot") || strings.Contains(got, "Budget Bites") || strings.Contains(got, "\n") {
+		t.Errorf("summary = %q, want the first sentence alone", got)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// modelProfile is a named bundle of generation settings selectable with the "profile"
+// request field. Profiles are defined in MODEL_PROFILES as a JSON object, e.g.
+//
+//	{"fast": {"model": "llama3.2:1b", "max_tokens": 256},
+//	 "quality": {"model": "llama3.1:8b", "temperature": 0.6, "max_tokens": 1024}}
+//
+// Explicit request fields override profile values.
+type modelProfile struct {
+	Model       string   `json:"model"`
+	Temperature *float64 `json:"temperature"`
+	MaxTokens   *int     `json:"max_tokens"`
+}
+
+// loadProfiles parses MODEL_PROFILES. An unset variable yields no profiles.
+func loadProfiles() (map[string]modelProfile, error) {
+	raw := os.Getenv("MODEL_PROFILES")
+	if raw == "" {
+		return nil, nil
+	}
+	var profiles map[string]modelProfile
+	if err := json.Unmarshal([]byte(raw), &profiles); err != nil {
+		return nil, fmt.Errorf("invalid MODEL_PROFILES: %w", err)
+	}
+	return profiles, nil
+}
+
+// resolveProfile looks up the named profile. An empty name returns nil; an unknown
+// name is an error.
+func resolveProfile(name string) (*modelProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	profiles, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, badRequest(fmt.Sprintf("unknown profile %q", name))
+	}
+	return &profile, nil
+}
+
+// loadModelDefaults parses MODEL_DEFAULTS, a JSON object mapping model names to the Ollama
+// options they use unless a request says otherwise, e.g.
+//
+//	{"qwen2.5-coder": {"temperature": 0}, "llama3.2": {"temperature": 0.7, "top_p": 0.9},
+//	 "*": {"temperature": 0.5}}
+//
+// The "*" entry applies to models not listed. An unset variable yields no defaults.
+func loadModelDefaults() (map[string]map[string]interface{}, error) {
+	raw := os.Getenv("MODEL_DEFAULTS")
+	if raw == "" {
+		return nil, nil
+	}
+	var defaults map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &defaults); err != nil {
+		return nil, fmt.Errorf("invalid MODEL_DEFAULTS: %w", err)
+	}
+	return defaults, nil
+}
+
+// modelDefaults returns a copy of the MODEL_DEFAULTS options for model, matched by its full
+// name, then by its name without the tag, then falling back to "*".
+func modelDefaults(model string) (map[string]interface{}, error) {
+	defaults, err := loadModelDefaults()
+	if err != nil {
+		return nil, err
+	}
+	name, _, _ := strings.Cut(model, ":")
+	options := make(map[string]interface{})
+	for _, key := range []string{model, name, "*"} {
+		if opts, ok := defaults[key]; ok {
+			for k, v := range opts {
+				options[k] = v
+			}
+			break
+		}
+	}
+	return options, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const testProfiles = `{"fast": {"model": "llama3.2:1b", "max_tokens": 256},
+	"quality": {"model": "llama3.1:8b", "temperature": 0.6, "max_tokens": 1024}}`
+
+func TestProfileSetsModelAndOptions(t *testing.T) {
+	t.Setenv("MODEL_PROFILES", testProfiles)
+	chatReq, err := buildChatRequest(RequestBody{Profile: "quality"}, "prompt")
+	if err != nil {
+		t.Fatalf("buildChatRequest: %v", err)
+	}
+	if chatReq.Model != "llama3.1:8b" || chatReq.Options["temperature"] != 0.6 || chatReq.Options["num_predict"] != 1024 {
+		t.Errorf("request = %s %v, want the quality profile's settings", chatReq.Model, chatReq.Options)
+	}
+}
+
+func TestRequestFieldsOverrideProfile(t *testing.T) {
+	t.Setenv("MODEL_PROFILES", testProfiles)
+	temperature, maxTokens := 0.1, 64
+	chatReq, err := buildChatRequest(RequestBody{Profile: "quality", Model: "mistral", Temperature: &temperature, MaxTokens: &maxTokens}, "prompt")
+	if err != nil {
+		t.Fatalf("buildChatRequest: %v", err)
+	}
+	if chatReq.Model != "mistral" || chatReq.Options["temperature"] != 0.1 || chatReq.Options["num_predict"] != 64 {
+		t.Errorf("request = %s %v, want the explicit fields to win", chatReq.Model, chatReq.Options)
+	}
+
+	// A profile's temperature also beats the tone's.
+	chatReq, _ = buildChatRequest(RequestBody{Profile: "quality", Tone: "creative"}, "prompt")
+	if chatReq.Options["temperature"] != 0.6 {
+		t.Errorf("temperature = %v, want the profile's over the tone's", chatReq.Options["temperature"])
+	}
+}
+
+func TestUnknownProfileIsBadRequest(t *testing.T) {
+	t.Setenv("MODEL_PROFILES", testProfiles)
+	_, err := buildChatRequest(RequestBody{Profile: "turbo"}, "prompt")
+	var he *httpError
+	if !errors.As(err, &he) || he.Status != http.StatusBadRequest {
+		t.Errorf("err = %v, want a 400", err)
+	}
+	if rec := postChatCompletion(t, `{"location": "San Francisco", "profile": "turbo"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestModelDefaults(t *testing.T) {
+	t.Setenv("MODEL_DEFAULTS", `{"codellama": {"temperature": 0, "top_p": 0.5}, "llama3.2:1b": {"temperature": 0.3}, "*": {"temperature": 0.7}}`)
+	tests := map[string]map[string]interface{}{
+		"codellama:7b": {"temperature": 0.0, "top_p": 0.5},
+		"llama3.2:1b":  {"temperature": 0.3},
+		"mistral":      {"temperature": 0.7},
+	}
+	for model, want := range tests {
+		chatReq, err := buildChatRequest(RequestBody{Model: model}, "prompt")
+		if err != nil {
+			t.Fatalf("%s: %v", model, err)
+		}
+		if !reflect.DeepEqual(chatReq.Options, want) {
+			t.Errorf("%s options = %v, want %v", model, chatReq.Options, want)
+		}
+	}
+
+	temperature, maxTokens := 1.2, 64
+	chatReq, err := buildChatRequest(RequestBody{Model: "codellama", Temperature: &temperature, MaxTokens: &maxTokens}, "prompt")
+	if err != nil {
+		t.Fatalf("buildChatRequest: %v", err)
+	}
+	if want := map[string]interface{}{"temperature": 1.2, "top_p": 0.5, "num_predict": 64}; !reflect.DeepEqual(chatReq.Options, want) {
+		t.Errorf("options = %v, want the request's values over the model defaults", chatReq.Options)
+	}
+
+	t.Setenv("MODEL_DEFAULTS", `{"codellama": "hot"}`)
+	if _, err := buildChatRequest(RequestBody{Model: "codellama"}, "prompt"); err == nil {
+		t.Error("buildChatRequest accepted invalid MODEL_DEFAULTS")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "os"
+
+// cachedSystemPrompt opens every conversation when PROMPT_CACHE is on. It never varies
+// between requests, so together with the few-shot examples it forms a prefix that Ollama
+// can serve from its KV cache instead of recomputing.
+const cachedSystemPrompt = "You are a local restaurant guide. You recommend restaurants only from the options " +
+	"listed in the user's message, using the details given for each, and never invent places or facts."
+
+// promptCacheEnabled reports whether PROMPT_CACHE=true.
+func promptCacheEnabled() bool {
+	return envBool("PROMPT_CACHE")
+}
+
+// stableMessages returns the request-independent messages that start the conversation when
+// prompt caching is on: cachedSystemPrompt followed by the few-shot examples. Anything that
+// varies per request, the tone included, must come after them.
+func stableMessages(examples []promptExample) []ChatMessage {
+	return append([]ChatMessage{{Role: "system", Content: cachedSystemPrompt}}, exampleMessages(examples)...)
+}
+
+// promptCacheKeepAlive returns how long Ollama should keep the model, and with it the cached
+// prefix, loaded after a request: PROMPT_CACHE_KEEP_ALIVE as an Ollama duration such as
+// "30m" or "-1" for forever, defaulting to 30 minutes. The keep_alive field needs
+// Ollama 0.1.23 or later; older versions ignore it and unload after their default 5 minutes.
+func promptCacheKeepAlive() string {
+	if v := os.Getenv("PROMPT_CACHE_KEEP_ALIVE"); v != "" {
+		return v
+	}
+	return "30m"
+}
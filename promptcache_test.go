@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestStablePrefixIsByteIdentical(t *testing.T) {
+	t.Setenv("PROMPT_CACHE", "true")
+	t.Setenv("PROMPT_EXAMPLES", `[{"input": "Sample context", "output": "Ideal reply"}]`)
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	postChatCompletion(t, `{"location": "San Francisco", "tone": "creative"}`)
+	postChatCompletion(t, `{"location": "Oakland", "query": "quiet dinner", "tone": "precise"}`)
+
+	sent := stub.received()
+	if len(sent) != 2 {
+		t.Fatalf("Ollama received %d requests, want 2", len(sent))
+	}
+	const stable = 3 // system prompt plus one example exchange
+	prefix := func(req ChatRequest) []byte {
+		data, err := json.Marshal(req.Messages[:stable])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	if a, b := prefix(sent[0]), prefix(sent[1]); !bytes.Equal(a, b) {
+		t.Errorf("stable prefixes differ:\n%s\n%s", a, b)
+	}
+	if sent[0].Messages[0].Content != cachedSystemPrompt {
+		t.Errorf("first message = %q, want the cached system prompt", sent[0].Messages[0].Content)
+	}
+	for _, req := range sent {
+		if tone := req.Messages[stable]; tone.Role != "system" || tone.Content == cachedSystemPrompt {
+			t.Errorf("message after the prefix = %+v, want the tone", tone)
+		}
+		if req.KeepAlive != "30m" {
+			t.Errorf("keep_alive = %q, want 30m", req.KeepAlive)
+		}
+	}
+}
+
+func TestPromptCacheOff(t *testing.T) {
+	chatReq, err := buildChatRequest(RequestBody{}, "prompt")
+	if err != nil {
+		t.Fatalf("buildChatRequest: %v", err)
+	}
+	if chatReq.KeepAlive != "" || chatReq.Messages[0].Content == cachedSystemPrompt {
+		t.Errorf("prompt cache hints sent while PROMPT_CACHE is off: %+v", chatReq)
+	}
+	t.Setenv("PROMPT_CACHE_KEEP_ALIVE", "-1")
+	if got := promptCacheKeepAlive(); got != "-1" {
+		t.Errorf("promptCacheKeepAlive = %q, want -1", got)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scoreWeights multiplies each scorable field in score. A positive weight favors higher
+// values of the field and a negative weight favors lower ones.
+type scoreWeights struct {
+	Rating   float64 // per star
+	Distance float64 // per mile
+	Price    float64 // per dollar
+	Family   float64 // flat bonus for family-friendly places; only set for family requests
+}
+
+// defaultWeights returns the configured weights: each star adds SCORE_WEIGHT_RATING
+// (default 1), each mile subtracts SCORE_WEIGHT_DISTANCE (default 0.5) and each dollar
+// subtracts SCORE_WEIGHT_PRICE (default 0).
+func defaultWeights() scoreWeights {
+	return scoreWeights{
+		Rating:   envFloat("SCORE_WEIGHT_RATING", 1),
+		Distance: -envFloat("SCORE_WEIGHT_DISTANCE", 0.5),
+		Price:    -envFloat("SCORE_WEIGHT_PRICE", 0),
+	}
+}
+
+// resolveWeights applies a request's preferences, e.g. {"rating": 2, "price": -1}, on top
+// of the configured weights. Fields the preferences leave out keep their configured weight.
+// Unknown keys are rejected. Family requests add FAMILY_BOOST (default 1) to the score of
+// family-friendly places, nudging them up rather than filtering out the rest.
+func resolveWeights(prefs map[string]float64, family bool) (scoreWeights, error) {
+	w := defaultWeights()
+	if family {
+		w.Family = envFloat("FAMILY_BOOST", 1)
+	}
+	for key, weight := range prefs {
+		switch key {
+		case "rating":
+			w.Rating = weight
+		case "distance":
+			w.Distance = weight
+		case "price":
+			w.Price = weight
+		default:
+			return w, fmt.Errorf("unknown preference %q (want rating, distance or price)", key)
+		}
+	}
+	return w, nil
+}
+
+// score returns how strongly a restaurant should be favored under w. Higher is better.
+func score(r Restaurant, w scoreWeights) float64 {
+	s := w.Rating*r.Rating + w.Distance*r.Distance + w.Price*r.Price
+	if familyFriendly(r) {
+		s += w.Family
+	}
+	return s
+}
+
+// familyFeatures are the features that mark a restaurant as good for children.
+var familyFeatures = []string{"kid_friendly", "high_chairs"}
+
+// familyFriendly reports whether r has any of familyFeatures.
+func familyFriendly(r Restaurant) bool {
+	for _, f := range familyFeatures {
+		if hasAllFeatures(r, []string{f}) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortRestaurants orders restaurants in place by mode: "score" (best blended score first),
+// "rating" (highest first), "distance" (closest first), "price" (cheapest first) or "none"
+// (provider order). An empty mode uses DEFAULT_SORT, which defaults to "score". Scores use w.
+//
+// Ties are broken by the comma-separated SORT_TIEBREAK keys in order (default
+// "rating,distance,name"), so equal entries come out in the same order on every run.
+func sortRestaurants(restaurants []Restaurant, mode string, w scoreWeights) error {
+	mode = sortMode(mode)
+	if mode == "none" {
+		return nil
+	}
+	primary := sortComparator(mode, w)
+	if primary == nil {
+		return fmt.Errorf("unknown sort %q (want score, rating, distance, price or none)", mode)
+	}
+	chain := []func(a, b Restaurant) int{primary}
+	for _, key := range tiebreakKeys() {
+		if c := sortComparator(key, w); c != nil {
+			chain = append(chain, c)
+		} else {
+			log.Printf("Ignoring unknown SORT_TIEBREAK key %q", key)
+		}
+	}
+
+	sort.SliceStable(restaurants, func(i, j int) bool {
+		for _, c := range chain {
+			if d := c(restaurants[i], restaurants[j]); d != 0 {
+				return d < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// sortMode resolves an empty sort mode to DEFAULT_SORT, and that to "score".
+func sortMode(mode string) string {
+	if mode == "" {
+		mode = os.Getenv("DEFAULT_SORT")
+	}
+	if mode == "" {
+		mode = "score"
+	}
+	return mode
+}
+
+// preferInstructions maps each prefer value to the prompt instruction telling the model how
+// to choose between options of similar quality. It steers the narrative only; the ranking
+// is unchanged.
+var preferInstructions = map[string]string{
+	"distance": "When options are of similar quality, prefer the closer one.",
+	"rating":   "When options are otherwise similar, prefer the better-rated one.",
+	"price":    "When options are of similar quality, prefer the cheaper one.",
+	"wait":     "When options are of similar quality, prefer the one with the shorter wait.",
+}
+
+// checkPrefer validates the prefer field; empty means no preference.
+func checkPrefer(prefer string) error {
+	if _, ok := preferInstructions[prefer]; prefer != "" && !ok {
+		return badRequest(fmt.Sprintf("unknown prefer %q (want distance, rating, price or wait)", prefer))
+	}
+	return nil
+}
+
+// tiebreakKeys returns the SORT_TIEBREAK keys, defaulting to rating, distance, then name.
+func tiebreakKeys() []string {
+	raw := os.Getenv("SORT_TIEBREAK")
+	if raw == "" {
+		raw = "rating,distance,name"
+	}
+	var keys []string
+	for _, key := range strings.Split(raw, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// sortComparator returns a comparison for key that is negative when a should come first,
+// or nil if key is unknown. Keys are the sort modes plus "name" (alphabetical).
+func sortComparator(key string, w scoreWeights) func(a, b Restaurant) int {
+	switch key {
+	case "score":
+		return func(a, b Restaurant) int { return compareFloats(score(b, w), score(a, w)) }
+	case "rating":
+		return func(a, b Restaurant) int { return compareFloats(b.Rating, a.Rating) }
+	case "distance":
+		return func(a, b Restaurant) int { return compareFloats(a.Distance, b.Distance) }
+	case "price":
+		return func(a, b Restaurant) int { return compareFloats(a.Price, b.Price) }
+	case "name":
+		return func(a, b Restaurant) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) }
+	default:
+		return nil
+	}
+}
+
+// compareFloats returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// newRNG returns a random source seeded with seed, or with the current time when seed is nil.
+func newRNG(seed *int64) *rand.Rand {
+	if seed != nil {
+		return rand.New(rand.NewSource(*seed))
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// nearestRestaurant returns the closest of restaurants that passed the filters (pinned
+// places kept despite failing them don't count), ties going to the earlier name
+// alphabetically. It returns nil when there are none or distances are unknown (geocoding
+// disabled).
+func nearestRestaurant(restaurants []Restaurant) *Restaurant {
+	if !geocodingEnabled() {
+		return nil
+	}
+	var nearest *Restaurant
+	for i, r := range restaurants {
+		if r.Unmatched {
+			continue
+		}
+		if nearest == nil || r.Distance < nearest.Distance || (r.Distance == nearest.Distance && r.Name < nearest.Name) {
+			nearest = &restaurants[i]
+		}
+	}
+	if nearest == nil {
+		return nil
+	}
+	r := *nearest
+	return &r
+}
+
+// shuffleRestaurants returns a copy of restaurants shuffled for presentation, or restaurants
+// itself when seed is nil. The order is deterministic per seed: the same seed always yields
+// the same order of the same restaurants. Ranking-based steps (token budget, featured pick,
+// alternatives) must run on the ranked list, never on the shuffled copy.
+func shuffleRestaurants(restaurants []Restaurant, seed *int64) []Restaurant {
+	if seed == nil {
+		return restaurants
+	}
+	shuffled := append([]Restaurant(nil), restaurants...)
+	rng := rand.New(rand.NewSource(*seed))
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+// pickFeatured selects one restaurant at random, weighted by score, so that
+// repeated identical requests don't always surface the same top-rated place.
+// It returns false if there is nothing to pick from.
+func pickFeatured(restaurants []Restaurant, w scoreWeights, rng *rand.Rand) (Restaurant, bool) {
+	if len(restaurants) == 0 {
+		return Restaurant{}, false
+	}
+
+	var total float64
+	for _, r := range restaurants {
+		if s := score(r, w); s > 0 {
+			total += s
+		}
+	}
+	if total == 0 {
+		return restaurants[rng.Intn(len(restaurants))], true
+	}
+
+	target := rng.Float64() * total
+	for _, r := range restaurants {
+		s := score(r, w)
+		if s <= 0 {
+			continue
+		}
+		if target < s {
+			return r, true
+		}
+		target -= s
+	}
+	return restaurants[len(restaurants)-1], true
+}
+
+// diversifyCuisines reorders ranked restaurants so the first topN include at least
+// minCuisines distinct cuisines when the data allows it. The lowest-ranked entry of a
+// repeated cuisine in the top group is swapped out for the best-ranked restaurant of a
+// cuisine not yet represented; everything else keeps its relative order. If there aren't
+// enough distinct cuisines, it does as well as it can.
+func diversifyCuisines(restaurants []Restaurant, topN, minCuisines int) []Restaurant {
+	return diversify(restaurants, topN, minCuisines, func(r Restaurant) string {
+		return strings.ToLower(r.Cuisine)
+	})
+}
+
+// diversifyPrices is diversifyCuisines for price tiers ($, $$, $$$): it makes the first topN
+// span at least minLevels tiers when the data allows it, promoting lower-ranked restaurants
+// as needed. Restaurants without a price count as no tier.
+func diversifyPrices(restaurants []Restaurant, topN, minLevels int) []Restaurant {
+	return diversify(restaurants, topN, minLevels, func(r Restaurant) string {
+		if r.Price <= 0 {
+			return ""
+		}
+		return priceTier(r.Price)
+	})
+}
+
+// diversify implements diversifyCuisines and diversifyPrices for any grouping key, where
+// an empty key means the restaurant belongs to no group.
+func diversify(restaurants []Restaurant, topN, minDistinct int, key func(Restaurant) string) []Restaurant {
+	if topN <= 0 || minDistinct <= 1 || len(restaurants) <= topN {
+		return restaurants
+	}
+	top := append([]Restaurant(nil), restaurants[:topN]...)
+	rest := append([]Restaurant(nil), restaurants[topN:]...)
+
+	counts := make(map[string]int)
+	for _, r := range top {
+		if k := key(r); k != "" {
+			counts[k]++
+		}
+	}
+
+	for i := 0; len(counts) < minDistinct && i < len(rest); i++ {
+		k := key(rest[i])
+		if k == "" || counts[k] > 0 {
+			continue
+		}
+		// Demote the lowest-ranked top entry whose group is represented more than once.
+		victim := -1
+		for j := len(top) - 1; j >= 0; j-- {
+			if c := key(top[j]); c == "" || counts[c] > 1 {
+				victim = j
+				break
+			}
+		}
+		if victim < 0 {
+			break
+		}
+		demoted := top[victim]
+		if c := key(demoted); c != "" {
+			counts[c]--
+		}
+		counts[k]++
+		top = append(append(top[:victim:victim], top[victim+1:]...), rest[i])
+		// Demoted goes to the front of rest; the following candidate stays at index i+1.
+		rest = append(append([]Restaurant{demoted}, rest[:i]...), rest[i+1:]...)
+	}
+	return append(top, rest...)
+}
+
+// explainRank returns a short, deterministic explanation of r's score under w, such as
+// "high rating, very close, mid price". Factors are listed by their contribution to the
+// score, largest first; factors with zero weight are left out.
+func explainRank(r Restaurant, w scoreWeights) string {
+	type factor struct {
+		label  string
+		weight float64
+	}
+	factors := []factor{
+		{ratingLabel(r.Rating), math.Abs(w.Rating * r.Rating)},
+		{distanceLabel(r.Distance), math.Abs(w.Distance * r.Distance)},
+		{priceLabel(r.Price), math.Abs(w.Price * r.Price)},
+	}
+	if familyFriendly(r) {
+		factors = append(factors, factor{"family friendly", math.Abs(w.Family)})
+	}
+	sort.SliceStable(factors, func(i, j int) bool { return factors[i].weight > factors[j].weight })
+
+	var labels []string
+	for _, f := range factors {
+		if f.weight > 0 {
+			labels = append(labels, f.label)
+		}
+	}
+	return strings.Join(labels, ", ")
+}
+
+func ratingLabel(rating float64) string {
+	switch {
+	case rating >= 4.5:
+		return "high rating"
+	case rating >= 3.5:
+		return "good rating"
+	default:
+		return "low rating"
+	}
+}
+
+func distanceLabel(miles float64) string {
+	switch {
+	case miles < 0.5:
+		return "very close"
+	case miles < 2:
+		return "nearby"
+	default:
+		return "farther away"
+	}
+}
+
+func priceLabel(price float64) string {
+	switch {
+	case price < 15:
+		return "low price"
+	case price < 40:
+		return "mid price"
+	default:
+		return "high price"
+	}
+}
+
+// pickSurprise chooses a random restaurant rated at least SURPRISE_MIN_RATING (default 4)
+// that isn't closed at t, for "surprise me" requests. It returns false when none qualifies.
+func pickSurprise(restaurants []Restaurant, t time.Time, rng *rand.Rand) (Restaurant, bool) {
+	minRating := envFloat("SURPRISE_MIN_RATING", 4)
+	var eligible []Restaurant
+	for _, r := range restaurants {
+		if r.Rating >= minRating && !closedAt(r, t) {
+			eligible = append(eligible, r)
+		}
+	}
+	if len(eligible) == 0 {
+		return Restaurant{}, false
+	}
+	return eligible[rng.Intn(len(eligible))], true
+}
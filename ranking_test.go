@@ -0,0 +1,437 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPickFeaturedFollowsScoreWeights(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "A", Rating: 1},
+		{Name: "B", Rating: 2},
+		{Name: "C", Rating: 3},
+		{Name: "D", Rating: 4},
+	}
+	w := scoreWeights{Rating: 1}
+	seed := int64(42)
+	rng := newRNG(&seed)
+
+	const runs = 20000
+	counts := make(map[string]int)
+	for i := 0; i < runs; i++ {
+		pick, ok := pickFeatured(restaurants, w, rng)
+		if !ok {
+			t.Fatal("pickFeatured found nothing to pick")
+		}
+		counts[pick.Name]++
+	}
+	for _, r := range restaurants {
+		want := r.Rating / 10
+		got := float64(counts[r.Name]) / runs
+		if math.Abs(got-want) > 0.02 {
+			t.Errorf("%s picked %.3f of the time, want about %.3f", r.Name, got, want)
+		}
+	}
+}
+
+func TestPickFeaturedIsDeterministicForASeed(t *testing.T) {
+	restaurants := []Restaurant{{Name: "A", Rating: 4}, {Name: "B", Rating: 4.5}, {Name: "C", Rating: 3}}
+	seed := int64(7)
+	first, second := newRNG(&seed), newRNG(&seed)
+	for i := 0; i < 50; i++ {
+		a, _ := pickFeatured(restaurants, defaultWeights(), first)
+		b, _ := pickFeatured(restaurants, defaultWeights(), second)
+		if a.Name != b.Name {
+			t.Fatalf("pick %d differs for the same seed: %s vs %s", i, a.Name, b.Name)
+		}
+	}
+}
+
+func TestPickFeaturedSkipsNonPositiveScores(t *testing.T) {
+	restaurants := []Restaurant{{Name: "Far", Rating: 1, Distance: 10}, {Name: "Near", Rating: 4, Distance: 1}}
+	seed := int64(1)
+	rng := newRNG(&seed)
+	for i := 0; i < 100; i++ {
+		if pick, _ := pickFeatured(restaurants, defaultWeights(), rng); pick.Name != "Near" {
+			t.Fatalf("picked %s, whose score is not positive", pick.Name)
+		}
+	}
+	if _, ok := pickFeatured(nil, defaultWeights(), rng); ok {
+		t.Error("pickFeatured picked from an empty list")
+	}
+}
+
+func TestBuildPromptFeaturesThePick(t *testing.T) {
+	restaurants := []Restaurant{{Name: "A", Rating: 4}, {Name: "B", Rating: 3}}
+	prompt := buildPrompt(promptInput{Location: "Town", Restaurants: restaurants, Featured: &restaurants[1]})
+	if !strings.Contains(prompt, "Feature B as the main pick") {
+		t.Errorf("prompt does not feature the pick:\n%s", prompt)
+	}
+}
+
+// rankingSample is in insertion order that no sensible ranking keeps.
+func rankingSample() []Restaurant {
+	return []Restaurant{
+		{Name: "Corner Cafe", Rating: 3.0, Distance: 0.2, Price: 10},
+		{Name: "Harbor Grill", Rating: 4.8, Distance: 0.5, Price: 35},
+		{Name: "Hilltop Inn", Rating: 4.0, Distance: 3.0, Price: 20},
+	}
+}
+
+func TestDefaultSortBlendsRatingAndDistance(t *testing.T) {
+	restaurants := rankingSample()
+	if err := sortRestaurants(restaurants, "", defaultWeights()); err != nil {
+		t.Fatalf("sortRestaurants: %v", err)
+	}
+	if got, want := names(restaurants), []string{"Harbor Grill", "Corner Cafe", "Hilltop Inn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("default order = %v, want %v", got, want)
+	}
+}
+
+func TestSortNoneKeepsProviderOrder(t *testing.T) {
+	restaurants := rankingSample()
+	if err := sortRestaurants(restaurants, "none", defaultWeights()); err != nil {
+		t.Fatalf("sortRestaurants: %v", err)
+	}
+	if got := names(restaurants); !reflect.DeepEqual(got, names(rankingSample())) {
+		t.Errorf("sort=none reordered the list: %v", got)
+	}
+
+	t.Setenv("DEFAULT_SORT", "none")
+	restaurants = rankingSample()
+	sortRestaurants(restaurants, "", defaultWeights())
+	if got := names(restaurants); !reflect.DeepEqual(got, names(rankingSample())) {
+		t.Errorf("DEFAULT_SORT=none reordered the list: %v", got)
+	}
+}
+
+func TestSortModes(t *testing.T) {
+	tests := map[string][]string{
+		"rating":   {"Harbor Grill", "Hilltop Inn", "Corner Cafe"},
+		"distance": {"Corner Cafe", "Harbor Grill", "Hilltop Inn"},
+		"price":    {"Corner Cafe", "Hilltop Inn", "Harbor Grill"},
+	}
+	for mode, want := range tests {
+		restaurants := rankingSample()
+		if err := sortRestaurants(restaurants, mode, defaultWeights()); err != nil {
+			t.Fatalf("sort %s: %v", mode, err)
+		}
+		if got := names(restaurants); !reflect.DeepEqual(got, want) {
+			t.Errorf("sort %s = %v, want %v", mode, got, want)
+		}
+	}
+	if err := sortRestaurants(rankingSample(), "vibes", defaultWeights()); err == nil {
+		t.Error("sortRestaurants accepted an unknown mode")
+	}
+}
+
+func TestDiversifyCuisinesPromotesOtherCuisines(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "I1", Cuisine: "italian"}, {Name: "I2", Cuisine: "italian"}, {Name: "I3", Cuisine: "Italian"},
+		{Name: "I4", Cuisine: "italian"}, {Name: "T1", Cuisine: "thai"}, {Name: "M1", Cuisine: "mexican"},
+	}
+	got := names(diversifyCuisines(restaurants, 3, 3))
+	if want := []string{"I1", "T1", "M1", "I2", "I3", "I4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("diversified order = %v, want %v", got, want)
+	}
+	if got := names(restaurants); got[1] != "I2" {
+		t.Error("diversifyCuisines modified its input")
+	}
+}
+
+func TestDiversifyCuisinesWithOneCuisine(t *testing.T) {
+	restaurants := []Restaurant{{Name: "I1", Cuisine: "italian"}, {Name: "I2", Cuisine: "italian"}, {Name: "I3", Cuisine: "italian"}}
+	if got := names(diversifyCuisines(restaurants, 2, 3)); !reflect.DeepEqual(got, []string{"I1", "I2", "I3"}) {
+		t.Errorf("single-cuisine order = %v, want it unchanged", got)
+	}
+	mixed := []Restaurant{{Name: "I1", Cuisine: "italian"}, {Name: "I2", Cuisine: "italian"}, {Name: "T1", Cuisine: "thai"}}
+	if got := names(diversifyCuisines(mixed, 2, 0)); !reflect.DeepEqual(got, []string{"I1", "I2", "T1"}) {
+		t.Errorf("disabled pass reordered the list: %v", got)
+	}
+}
+
+func TestPreferencesChangeOrdering(t *testing.T) {
+	tests := []struct {
+		prefs map[string]float64
+		want  []string
+	}{
+		{map[string]float64{"rating": 1, "distance": 0, "price": 0}, []string{"Harbor Grill", "Hilltop Inn", "Corner Cafe"}},
+		{map[string]float64{"rating": 0, "distance": -1}, []string{"Corner Cafe", "Harbor Grill", "Hilltop Inn"}},
+		{map[string]float64{"rating": 0, "distance": 0, "price": -1}, []string{"Corner Cafe", "Hilltop Inn", "Harbor Grill"}},
+		{map[string]float64{"price": 1}, []string{"Harbor Grill", "Hilltop Inn", "Corner Cafe"}},
+	}
+	for _, tt := range tests {
+		w, err := resolveWeights(tt.prefs, false)
+		if err != nil {
+			t.Fatalf("resolveWeights(%v): %v", tt.prefs, err)
+		}
+		restaurants := rankingSample()
+		sortRestaurants(restaurants, "score", w)
+		if got := names(restaurants); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("preferences %v order %v, want %v", tt.prefs, got, tt.want)
+		}
+	}
+}
+
+func TestResolveWeightsRejectsUnknownKeys(t *testing.T) {
+	if _, err := resolveWeights(map[string]float64{"vibes": 1}, false); err == nil {
+		t.Error("resolveWeights accepted an unknown preference")
+	}
+	w, _ := resolveWeights(map[string]float64{"rating": 3}, false)
+	if w.Rating != 3 || w.Distance != defaultWeights().Distance {
+		t.Errorf("weights = %+v, want rating overridden and distance kept", w)
+	}
+}
+
+func TestExplainRank(t *testing.T) {
+	tests := []struct {
+		r    Restaurant
+		w    scoreWeights
+		want string
+	}{
+		{Restaurant{Rating: 4.7, Distance: 0.3, Price: 25}, scoreWeights{Rating: 1, Distance: -0.5}, "high rating, very close"},
+		{Restaurant{Rating: 3.0, Distance: 4, Price: 45}, scoreWeights{Rating: 1, Distance: -1, Price: -0.05}, "farther away, low rating, high price"},
+		{Restaurant{Rating: 4.0, Distance: 1, Price: 12, Features: []string{"kid_friendly"}}, scoreWeights{Rating: 1, Distance: -0.5, Family: 1}, "good rating, family friendly, nearby"},
+	}
+	for _, tt := range tests {
+		if got := explainRank(tt.r, tt.w); got != tt.want {
+			t.Errorf("explainRank(%+v) = %q, want %q", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestSortTiesAreStable(t *testing.T) {
+	tied := func() []Restaurant {
+		return []Restaurant{
+			{Name: "Zest", Rating: 4.5, Distance: 1.0},
+			{Name: "Alder", Rating: 4.5, Distance: 1.0},
+			{Name: "Maple", Rating: 4.5, Distance: 0.4},
+			{Name: "Birch", Rating: 3.9, Distance: 0.1},
+		}
+	}
+	want := []string{"Maple", "Alder", "Zest", "Birch"}
+	for i := 0; i < 20; i++ {
+		restaurants := tied()
+		if i%2 == 1 {
+			restaurants[0], restaurants[1] = restaurants[1], restaurants[0]
+		}
+		sortRestaurants(restaurants, "rating", defaultWeights())
+		if got := names(restaurants); !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: order = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestSortTiebreakIsConfigurable(t *testing.T) {
+	t.Setenv("SORT_TIEBREAK", "name")
+	restaurants := []Restaurant{
+		{Name: "Zest", Rating: 4.5, Distance: 0.2},
+		{Name: "Alder", Rating: 4.5, Distance: 1.0},
+	}
+	sortRestaurants(restaurants, "rating", defaultWeights())
+	if got := names(restaurants); !reflect.DeepEqual(got, []string{"Alder", "Zest"}) {
+		t.Errorf("SORT_TIEBREAK=name order = %v, want alphabetical", got)
+	}
+}
+
+func TestFamilyBoost(t *testing.T) {
+	sample := func() []Restaurant {
+		return []Restaurant{
+			{Name: "Bistro", Rating: 4.6, Distance: 0.5},
+			{Name: "Playhouse", Rating: 4.0, Distance: 0.5, Features: []string{"high_chairs"}},
+			{Name: "Far Diner", Rating: 3.0, Distance: 6, Features: []string{"kid_friendly"}},
+		}
+	}
+	rank := func(family bool) []string {
+		w, err := resolveWeights(nil, family)
+		if err != nil {
+			t.Fatalf("resolveWeights: %v", err)
+		}
+		restaurants := sample()
+		sortRestaurants(restaurants, "score", w)
+		return names(restaurants)
+	}
+
+	if got, want := rank(false), []string{"Bistro", "Playhouse", "Far Diner"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without family order = %v, want %v", got, want)
+	}
+	if got, want := rank(true), []string{"Playhouse", "Bistro", "Far Diner"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("family order = %v, want %v", got, want)
+	}
+
+	t.Setenv("FAMILY_BOOST", "0.2")
+	if got := rank(true); got[0] != "Bistro" {
+		t.Errorf("small FAMILY_BOOST order = %v, want the boost too small to reorder", got)
+	}
+}
+
+func TestPreferInstruction(t *testing.T) {
+	for prefer, want := range preferInstructions {
+		prompt := buildPrompt(promptInput{Location: "Town", Restaurants: rankingSample(), Prefer: prefer})
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prefer=%s prompt lacks %q:\n%s", prefer, want, prompt)
+		}
+	}
+	if prompt := buildPrompt(promptInput{Location: "Town", Restaurants: rankingSample()}); strings.Contains(prompt, "When options are") {
+		t.Errorf("prompt without prefer has a tie instruction:\n%s", prompt)
+	}
+	if err := checkPrefer("vibes"); err == nil {
+		t.Error("checkPrefer accepted an unknown value")
+	}
+
+	stub := newOllamaStub(t, reply("Try Budget Bites."))
+	postChatCompletion(t, `{"location": "San Francisco", "prefer": "distance"}`)
+	sent := stub.received()[0]
+	if !strings.Contains(sent.Messages[0].Content, "When options are of similar quality, prefer the closer one.") {
+		t.Errorf("sent prompt lacks the distance preference:\n%s", sent.Messages[0].Content)
+	}
+}
+
+func TestDiversifyPricesSpansTiers(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "A", Price: 20}, {Name: "B", Price: 25}, {Name: "C", Price: 30},
+		{Name: "D", Price: 12}, {Name: "E", Price: 50}, {Name: "F", Price: 35},
+	}
+	got := names(diversifyPrices(restaurants, 3, 3))
+	if want := []string{"A", "D", "E", "B", "C", "F"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("diversified order = %v, want %v", got, want)
+	}
+	if got := names(diversifyPrices(restaurants, 3, 0)); !reflect.DeepEqual(got, names(restaurants)) {
+		t.Errorf("disabled pass reordered the list: %v", got)
+	}
+}
+
+func TestDiversifyPricesDegradesGracefully(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "A", Price: 20}, {Name: "B", Price: 25}, {Name: "C", Price: 30},
+		{Name: "D", Price: 12}, {Name: "Free", Price: 0}, {Name: "F", Price: 35},
+	}
+	// Only two tiers exist, and an unpriced place counts as none.
+	got := names(diversifyPrices(restaurants, 3, 3))
+	if want := []string{"A", "B", "D", "C", "Free", "F"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("diversified order = %v, want %v", got, want)
+	}
+}
+
+func TestShuffleRestaurantsBySeed(t *testing.T) {
+	var restaurants []Restaurant
+	for _, name := range strings.Fields("A B C D E F G H I J") {
+		restaurants = append(restaurants, Restaurant{Name: name})
+	}
+	shuffled := func(seed int64) []string { return names(shuffleRestaurants(restaurants, &seed)) }
+
+	first := shuffled(1)
+	if again := shuffled(1); !reflect.DeepEqual(first, again) {
+		t.Errorf("seed 1 gave %v and then %v", first, again)
+	}
+	if other := shuffled(2); reflect.DeepEqual(first, other) {
+		t.Errorf("seeds 1 and 2 both gave %v", first)
+	}
+	if got := names(restaurants); got[0] != "A" || got[9] != "J" {
+		t.Errorf("shuffleRestaurants modified its input: %v", got)
+	}
+	if got := names(shuffleRestaurants(restaurants, nil)); !reflect.DeepEqual(got, names(restaurants)) {
+		t.Errorf("no seed reordered the list: %v", got)
+	}
+}
+
+func TestNearestRestaurant(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "Mid", Distance: 0.9},
+		{Name: "Pinned", Distance: 0.1, Unmatched: true},
+		{Name: "Zeta", Distance: 0.4},
+		{Name: "Alpha", Distance: 0.4},
+		{Name: "Far", Distance: 3},
+	}
+	nearest := nearestRestaurant(restaurants)
+	if nearest == nil || nearest.Name != "Alpha" {
+		t.Fatalf("nearest = %+v, want Alpha", nearest)
+	}
+	nearest.Name = "changed"
+	if restaurants[3].Name != "Alpha" {
+		t.Error("nearestRestaurant returned a pointer into its input")
+	}
+	if nearestRestaurant(nil) != nil {
+		t.Error("nearest of nothing is not nil")
+	}
+	t.Setenv("ENABLE_GEOCODING", "false")
+	if nearestRestaurant(restaurants) != nil {
+		t.Error("nearest reported with distances unknown")
+	}
+}
+
+func TestNearestInChatResponse(t *testing.T) {
+	newOllamaStub(t, reply("Fancy Eats is worth the walk."))
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco", "sort": "rating"}`))
+	nearest, _ := resp["nearest"].(map[string]interface{})
+	if nearest["name"] != "The Gourmet Spot" || nearest["distance"] != 0.5 {
+		t.Errorf("nearest = %v, want The Gourmet Spot at 0.5 mi", resp["nearest"])
+	}
+}
+
+func TestPickSurpriseIsSeededAndValid(t *testing.T) {
+	noon := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	restaurants := []Restaurant{
+		{Name: "Low", Rating: 3.2},
+		{Name: "Open A", Rating: 4.1, Hours: everyDay("11:00", "22:00")},
+		{Name: "Open B", Rating: 4.6},
+		{Name: "Evening", Rating: 4.9, Hours: everyDay("17:00", "23:00")},
+	}
+	seed := int64(11)
+	first, _ := pickSurprise(restaurants, noon, newRNG(&seed))
+	for i := 0; i < 10; i++ {
+		if again, _ := pickSurprise(restaurants, noon, newRNG(&seed)); again.Name != first.Name {
+			t.Fatalf("seed %d picked %s and then %s", seed, first.Name, again.Name)
+		}
+	}
+
+	rng := newRNG(&seed)
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		pick, ok := pickSurprise(restaurants, noon, rng)
+		if !ok {
+			t.Fatal("pickSurprise found nothing eligible")
+		}
+		seen[pick.Name] = true
+	}
+	if seen["Low"] || seen["Evening"] {
+		t.Errorf("picked %v, want only well-rated places open at noon", seen)
+	}
+	if !seen["Open A"] || !seen["Open B"] {
+		t.Errorf("picked %v, want both eligible places over many draws", seen)
+	}
+
+	if _, ok := pickSurprise(restaurants[3:], noon, rng); ok {
+		t.Error("pickSurprise chose a closed restaurant")
+	}
+}
+
+func TestSurpriseRequest(t *testing.T) {
+	zones.flush("")
+	t.Cleanup(func() { zones.flush("") })
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	// Lunchtime: Fancy Eats, the best rated, only opens in the evening.
+	setClock(t, time.Date(2024, 5, 1, 12, 0, 0, 0, la))
+	stub := newOllamaStub(t, reply("Surprise!"))
+
+	for seed := 0; seed < 5; seed++ {
+		body := `{"location": "San Francisco", "surprise": true, "query": "french", "seed": ` + strconv.Itoa(seed) + `}`
+		if rec := postChatCompletion(t, body); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+	for _, req := range stub.received() {
+		prompt := req.Messages[0].Content
+		if !strings.Contains(prompt, "enthusiastically present ") {
+			t.Fatalf("prompt lacks the surprise instruction:\n%s", prompt)
+		}
+		if strings.Contains(prompt, "present Fancy Eats") {
+			t.Error("surprised with a closed restaurant")
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "strings"
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// splitReasoning separates <think>...</think> sections (emitted by reasoning models such as
+// deepseek-r1) from the answer. An unterminated <think> block is treated as reasoning up to the
+// end of the content, and a stray </think> with no opening tag marks everything before it as reasoning.
+func splitReasoning(content string) (answer, reasoning string) {
+	var answerParts, reasoningParts []string
+
+	// Some chat templates open the block in the prompt, so only the closing tag is emitted.
+	if closeIdx := strings.Index(content, thinkClose); closeIdx >= 0 {
+		if openIdx := strings.Index(content, thinkOpen); openIdx < 0 || openIdx > closeIdx {
+			reasoningParts = append(reasoningParts, content[:closeIdx])
+			content = content[closeIdx+len(thinkClose):]
+		}
+	}
+
+	for {
+		openIdx := strings.Index(content, thinkOpen)
+		if openIdx < 0 {
+			answerParts = append(answerParts, content)
+			break
+		}
+		answerParts = append(answerParts, content[:openIdx])
+		content = content[openIdx+len(thinkOpen):]
+
+		closeIdx := strings.Index(content, thinkClose)
+		if closeIdx < 0 {
+			reasoningParts = append(reasoningParts, content)
+			break
+		}
+		reasoningParts = append(reasoningParts, content[:closeIdx])
+		content = content[closeIdx+len(thinkClose):]
+	}
+
+	answer = strings.TrimSpace(strings.Join(answerParts, ""))
+	for i, part := range reasoningParts {
+		reasoningParts[i] = strings.TrimSpace(part)
+	}
+	reasoning = strings.TrimSpace(strings.Join(reasoningParts, "\n\n"))
+	return answer, reasoning
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSplitReasoning(t *testing.T) {
+	tests := []struct {
+		name, content, answer, reasoning string
+	}{
+		{"no reasoning", "Try Fancy Eats.", "Try Fancy Eats.", ""},
+		{"leading block", "<think>They want French.</think>\n\nTry Fancy Eats.", "Try Fancy Eats.", "They want French."},
+		{"two blocks", "<think>one</think>Try <think>two</think>Fancy Eats.", "Try Fancy Eats.", "one\n\ntwo"},
+		{"unterminated", "Try Fancy Eats.<think>still thinking", "Try Fancy Eats.", "still thinking"},
+		{"only closing tag", "opened by the template</think>Try Fancy Eats.", "Try Fancy Eats.", "opened by the template"},
+		{"only reasoning", "<think>hmm</think>", "", "hmm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, reasoning := splitReasoning(tt.content)
+			if answer != tt.answer {
+				t.Errorf("answer = %q, want %q", answer, tt.answer)
+			}
+			if reasoning != tt.reasoning {
+				t.Errorf("reasoning = %q, want %q", reasoning, tt.reasoning)
+			}
+		})
+	}
+}
+
+func TestIncludeReasoning(t *testing.T) {
+	newOllamaStub(t, reply("<think>They want French.</think>Try Fancy Eats."))
+
+	for _, include := range []bool{false, true} {
+		body := fmt.Sprintf(`{"location": "San Francisco", "include_reasoning": %v}`, include)
+		resp := decodeJSON(t, postChatCompletion(t, body))
+		if got := messageContent(t, resp); got != "Try Fancy Eats." {
+			t.Errorf("include_reasoning=%v: content = %q, want the answer alone", include, got)
+		}
+		message := resp["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})
+		reasoning, ok := message["reasoning"]
+		if include && reasoning != "They want French." {
+			t.Errorf("reasoning = %v, want the think block", reasoning)
+		}
+		if !include && ok {
+			t.Errorf("reasoning returned without include_reasoning: %v", reasoning)
+		}
+	}
+}
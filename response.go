@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// chatResult is everything a chat completion produced, independent of how it is rendered.
+type chatResult struct {
+	Model        string
+	Content      string
+	Reasoning    string // only set when the client asked for it
+	ToolCalls    []OllamaToolCall
+	FinishReason string        // overrides the finish reason derived from ToolCalls
+	Restaurants  []Restaurant  // the candidates shown to the model
+	Alternatives []Alternative // nil unless the client asked for alternatives
+	WantAlts     bool          // render alternatives even when there are none
+	Warnings     []string
+
+	Recommendation *Recommendation        // set for structured requests when a pick was found
+	LowConfidence  bool                   // the pick's confidence is below CONFIDENCE_THRESHOLD
+	Metadata       json.RawMessage        // the request's metadata, echoed back unchanged
+	AppliedFilters map[string]interface{} // see candidates.appliedFilters
+	DataAge        int                    // seconds since the restaurant data was fetched
+	Translations   map[string]string      // reply text by language, for multi-language requests
+	Suggestion     string                 // corrected cuisine when the requested one matched nothing
+	Nearest        *Restaurant            // the closest candidate after filters; nil when distances are unknown
+	RawOllama      string                 // the raw Ollama reply, only for debug requests with DEBUG_ENDPOINTS=true
+}
+
+// responseBuilders maps response_style values to the function rendering that shape.
+var responseBuilders = map[string]func(chatResult) map[string]interface{}{
+	"openai": openAIResponse,
+	"simple": simpleResponse,
+}
+
+// responseBuilder returns the builder for style, falling back to RESPONSE_STYLE and then
+// "openai" when style is empty.
+func responseBuilder(style string) (func(chatResult) map[string]interface{}, error) {
+	if style == "" {
+		style = os.Getenv("RESPONSE_STYLE")
+	}
+	if style == "" {
+		style = "openai"
+	}
+	build, ok := responseBuilders[style]
+	if !ok {
+		return nil, badRequest(fmt.Sprintf("unknown response_style %q (want openai or simple)", style))
+	}
+	return build, nil
+}
+
+// openAIResponse renders res in OpenAI's chat completion format.
+func openAIResponse(res chatResult) map[string]interface{} {
+	message := map[string]interface{}{"role": "assistant", "content": res.Content}
+	if res.Reasoning != "" {
+		message["reasoning"] = res.Reasoning
+	}
+	finishReason := "stop"
+	if len(res.ToolCalls) > 0 {
+		message["tool_calls"] = toOpenAIToolCalls(res.ToolCalls)
+		finishReason = "tool_calls"
+	}
+	if res.FinishReason != "" {
+		finishReason = res.FinishReason
+	}
+
+	response := map[string]interface{}{
+		"id":      "chatcmpl-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   res.Model,
+		"choices": []map[string]interface{}{
+			{
+				"index":         0,
+				"message":       message,
+				"finish_reason": finishReason,
+			},
+		},
+	}
+	if res.Recommendation != nil {
+		response["recommendation"] = res.Recommendation
+	}
+	addExtras(response, res)
+	return response
+}
+
+// simpleResponse renders res as {"recommendation": "...", "restaurants": [...]} for
+// clients that don't need OpenAI compatibility. Since "recommendation" holds the text here,
+// a structured pick goes in "recommendation_details".
+func simpleResponse(res chatResult) map[string]interface{} {
+	response := map[string]interface{}{
+		"recommendation": res.Content,
+		"restaurants":    res.Restaurants,
+		"model":          res.Model,
+	}
+	if res.Reasoning != "" {
+		response["reasoning"] = res.Reasoning
+	}
+	if len(res.ToolCalls) > 0 {
+		response["tool_calls"] = toOpenAIToolCalls(res.ToolCalls)
+	}
+	if res.Recommendation != nil {
+		response["recommendation_details"] = res.Recommendation
+	}
+	addExtras(response, res)
+	return response
+}
+
+// addExtras adds the top-level fields shared by every response style.
+func addExtras(response map[string]interface{}, res chatResult) {
+	if res.WantAlts {
+		response["alternatives"] = res.Alternatives
+	}
+	if len(res.Warnings) > 0 {
+		response["warnings"] = res.Warnings
+	}
+	if res.LowConfidence {
+		response["low_confidence"] = true
+	}
+	if len(res.Metadata) > 0 {
+		response["metadata"] = res.Metadata
+	}
+	if res.AppliedFilters != nil {
+		response["applied_filters"] = res.AppliedFilters
+	}
+	response["data_age_seconds"] = res.DataAge
+	if res.Translations != nil {
+		response["translations"] = res.Translations
+	}
+	if res.Nearest != nil {
+		response["nearest"] = res.Nearest
+	}
+	if res.Suggestion != "" {
+		response["suggestion"] = map[string]string{"cuisine": res.Suggestion}
+	}
+	if res.RawOllama != "" {
+		response["debug"] = map[string]interface{}{"raw_ollama": res.RawOllama}
+	}
+}
+
+// checkMetadata validates a request's metadata: it must be a JSON object of at most
+// METADATA_MAX_BYTES (default 1024) bytes.
+func checkMetadata(metadata json.RawMessage) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	if limit := envInt("METADATA_MAX_BYTES", 1024); len(metadata) > limit {
+		return badRequest(fmt.Sprintf("metadata must be at most %d bytes", limit))
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(metadata, &obj); err != nil || obj == nil {
+		return badRequest("metadata must be a JSON object")
+	}
+	return nil
+}
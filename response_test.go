@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// styleSample is a result rendered by both response styles.
+func styleSample() chatResult {
+	return chatResult{
+		Model:       "llama3.2",
+		Content:     "Try Budget Bites.",
+		Restaurants: []Restaurant{{Name: "Budget Bites", Cuisine: "italian"}},
+		Warnings:    []string{"current weather unavailable"},
+	}
+}
+
+// roundTrip renders response to JSON and back, as a client would see it.
+func roundTrip(t *testing.T, response map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out map[string]interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func TestOpenAIResponseStyle(t *testing.T) {
+	resp := roundTrip(t, openAIResponse(styleSample()))
+	if resp["object"] != "chat.completion" || resp["model"] != "llama3.2" {
+		t.Errorf("response = %v, want an OpenAI chat completion", resp)
+	}
+	if got := messageContent(t, resp); got != "Try Budget Bites." {
+		t.Errorf("content = %q", got)
+	}
+	if _, ok := resp["restaurants"]; ok {
+		t.Error("openai style lists the restaurants")
+	}
+	if !reflect.DeepEqual(resp["warnings"], []interface{}{"current weather unavailable"}) {
+		t.Errorf("warnings = %v", resp["warnings"])
+	}
+}
+
+func TestSimpleResponseStyle(t *testing.T) {
+	resp := roundTrip(t, simpleResponse(styleSample()))
+	if resp["recommendation"] != "Try Budget Bites." {
+		t.Errorf("recommendation = %v", resp["recommendation"])
+	}
+	restaurants, _ := resp["restaurants"].([]interface{})
+	if len(restaurants) != 1 || restaurants[0].(map[string]interface{})["name"] != "Budget Bites" {
+		t.Errorf("restaurants = %v", resp["restaurants"])
+	}
+	if _, ok := resp["choices"]; ok {
+		t.Error("simple style has OpenAI choices")
+	}
+	if !reflect.DeepEqual(resp["warnings"], []interface{}{"current weather unavailable"}) {
+		t.Errorf("warnings = %v", resp["warnings"])
+	}
+}
+
+func TestResponseBuilderSelection(t *testing.T) {
+	if _, err := responseBuilder("xml"); err == nil {
+		t.Error("responseBuilder accepted an unknown style")
+	}
+	t.Setenv("RESPONSE_STYLE", "simple")
+	build, err := responseBuilder("")
+	if err != nil {
+		t.Fatalf("responseBuilder: %v", err)
+	}
+	if _, ok := build(styleSample())["choices"]; ok {
+		t.Error("RESPONSE_STYLE=simple still built the OpenAI shape")
+	}
+
+	newOllamaStub(t, reply("Try Budget Bites."))
+	rec := postChatCompletion(t, `{"location": "San Francisco", "response_style": "openai"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := decodeJSON(t, rec)["choices"]; !ok {
+		t.Error("response_style=openai did not override RESPONSE_STYLE")
+	}
+}
+
+func TestMetadataRoundTrips(t *testing.T) {
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	rec := postChatCompletion(t, `{"location": "San Francisco", "metadata": {"ticket": "T-42", "tags": ["a", 1]}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := map[string]interface{}{"ticket": "T-42", "tags": []interface{}{"a", 1.0}}
+	if got := decodeJSON(t, rec)["metadata"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("metadata = %v, want %v", got, want)
+	}
+	if prompt := stub.received()[0].Messages[0].Content; strings.Contains(prompt, "T-42") {
+		t.Error("metadata leaked into the prompt")
+	}
+}
+
+func TestMetadataIsValidated(t *testing.T) {
+	t.Setenv("METADATA_MAX_BYTES", "32")
+	newOllamaStub(t, reply("Try Fancy Eats."))
+	for _, metadata := range []string{`{"note": "` + strings.Repeat("x", 40) + `"}`, `["not", "an", "object"]`, `null`} {
+		if rec := postChatCompletion(t, `{"location": "San Francisco", "metadata": `+metadata+`}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("metadata %s: status %d, want 400", metadata, rec.Code)
+		}
+	}
+}
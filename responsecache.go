@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseCache stores encoded chat completions for repeated deterministic requests.
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	body      []byte
+	area      string // searchArea.key() of the request, for flushing one location
+	expiresAt time.Time
+}
+
+var responses = &responseCache{entries: make(map[string]cachedResponse)}
+
+// get returns the cached body for key if it hasn't expired.
+func (c *responseCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		return nil, false
+	}
+	return e.body, true
+}
+
+// set stores body for a request in area under key for ttl, dropping expired entries.
+func (c *responseCache) set(key, area string, body []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedResponse{body: body, area: area, expiresAt: now.Add(ttl)}
+}
+
+// flush removes the entries for area, or all entries when area is empty, and returns
+// how many were removed.
+func (c *responseCache) flush(area string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for k, e := range c.entries {
+		if area == "" || e.area == area {
+			delete(c.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// responseCacheKey returns the cache key for a request, or "" when its response must not
+// be cached: caching is off unless RESPONSE_CACHE_TTL is set, and only deterministic
+// requests (temperature 0 or a fixed seed) qualify, so sampled variety is never replayed.
+// Besides the body, the key covers what in resolved from the clock and the request
+// headers: the reply language, the meal and each candidate's closing time, so a reply
+// cached at lunch is not replayed at dinner. Weather is fetched after the lookup and is
+// not part of the key; RESPONSE_CACHE_TTL bounds how stale it can get.
+func responseCacheKey(reqData RequestBody, chatReq ChatRequest, in promptInput) string {
+	if envDuration("RESPONSE_CACHE_TTL", 0) <= 0 {
+		return ""
+	}
+	temperature, hasTemp := chatReq.Options["temperature"].(float64)
+	if !(hasTemp && temperature == 0) && reqData.Seed == nil {
+		return ""
+	}
+
+	type candidate struct {
+		Name     string
+		ClosesIn *int
+	}
+	candidates := make([]candidate, len(in.Restaurants))
+	for i, r := range in.Restaurants {
+		candidates[i] = candidate{r.Name, r.ClosesInMinutes}
+	}
+	reqData.Location = strings.ToLower(strings.TrimSpace(reqData.Location))
+	reqData.Query = strings.ToLower(strings.TrimSpace(reqData.Query))
+	reqData.User = "" // identifies the caller, not the request
+	reqData.Model = chatReq.Model
+	normalized, err := json.Marshal(struct {
+		Request    RequestBody
+		Images     []string // not marshaled as part of RequestBody
+		Language   string
+		Meal       string
+		Candidates []candidate
+	}{reqData, reqData.Images, in.Language, in.Meal, candidates})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResponseCacheHitsForDeterministicRequests(t *testing.T) {
+	responses.flush("")
+	t.Cleanup(func() { responses.flush("") })
+	t.Setenv("RESPONSE_CACHE_TTL", "1m")
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	body := `{"location": "San Francisco", "temperature": 0}`
+
+	first := postChatCompletion(t, body)
+	if first.Code != http.StatusOK || first.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request: status %d, X-Cache %q, want a 200 MISS", first.Code, first.Header().Get("X-Cache"))
+	}
+	second := postChatCompletion(t, `{"location": " san francisco ", "temperature": 0}`)
+	if second.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("repeat X-Cache = %q, want HIT", second.Header().Get("X-Cache"))
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Error("cached body differs from the original")
+	}
+	if n := len(stub.received()); n != 1 {
+		t.Errorf("Ollama called %d times, want 1", n)
+	}
+}
+
+func TestResponseCacheSkipsSampledRequests(t *testing.T) {
+	responses.flush("")
+	t.Cleanup(func() { responses.flush("") })
+	t.Setenv("RESPONSE_CACHE_TTL", "1m")
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	body := `{"location": "San Francisco", "temperature": 0.8}`
+	for i := 0; i < 2; i++ {
+		if rec := postChatCompletion(t, body); rec.Header().Get("X-Cache") != "" {
+			t.Errorf("request %d X-Cache = %q, want the request not cached", i, rec.Header().Get("X-Cache"))
+		}
+	}
+	if n := len(stub.received()); n != 2 {
+		t.Errorf("Ollama called %d times, want every request to reach it", n)
+	}
+
+	seeded := `{"location": "San Francisco", "temperature": 0.8, "seed": 3}`
+	postChatCompletion(t, seeded)
+	if rec := postChatCompletion(t, seeded); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("seeded repeat X-Cache = %q, want HIT", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestResponseCacheHitSkipsEnrichment(t *testing.T) {
+	responses.flush("")
+	t.Cleanup(func() { responses.flush("") })
+	t.Setenv("RESPONSE_CACHE_TTL", "1m")
+	t.Setenv("SENTIMENT_METHOD", "model")
+	setProvider(t, reviewedProvider)
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	body := `{"location": "San Francisco", "temperature": 0}`
+
+	postChatCompletion(t, body)
+	calls := len(stub.received())
+	if rec := postChatCompletion(t, body); rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("repeat X-Cache = %q, want HIT", rec.Header().Get("X-Cache"))
+	}
+	if n := len(stub.received()) - calls; n != 0 {
+		t.Errorf("cache hit made %d model calls, want none", n)
+	}
+}
+
+func TestResponseCacheKeyCoversResolvedInputs(t *testing.T) {
+	t.Setenv("RESPONSE_CACHE_TTL", "1m")
+	reqData := RequestBody{Location: "San Francisco"}
+	chatReq := ChatRequest{Model: "llama3", Options: map[string]interface{}{"temperature": 0.0}}
+	lunch := promptInput{Language: "en", Meal: "lunch", Restaurants: []Restaurant{{Name: "Fancy Eats"}}}
+	base := responseCacheKey(reqData, chatReq, lunch)
+	if base == "" {
+		t.Fatal("deterministic request has no cache key")
+	}
+	if responseCacheKey(reqData, chatReq, lunch) != base {
+		t.Error("cache key is not stable")
+	}
+
+	dinner := lunch
+	dinner.Meal = "dinner"
+	closing := lunch
+	closing.Restaurants = []Restaurant{{Name: "Fancy Eats", ClosesInMinutes: intPtr(20)}}
+	french := lunch
+	french.Language = "fr"
+	for name, in := range map[string]promptInput{"meal": dinner, "closing time": closing, "language": french} {
+		if responseCacheKey(reqData, chatReq, in) == base {
+			t.Errorf("a different %s shares the cache key", name)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpError is an error that should be reported to the client with a specific status.
+type httpError struct {
+	Status  int
+	Message string
+	Err     error // underlying cause; logged, and shown to clients only with ERROR_VERBOSITY=full
+}
+
+func (e *httpError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *httpError) Unwrap() error {
+	return e.Err
+}
+
+// badRequest returns an httpError with status 400.
+func badRequest(msg string) error {
+	return &httpError{Status: http.StatusBadRequest, Message: msg}
+}
+
+// writeError reports err to the client, using its status if it is an httpError
+// and a generic 500 otherwise.
+//
+// Server errors are logged in full under a random error ID, which is returned in the
+// X-Error-ID header and the body so reports can be matched to logs. By default
+// (ERROR_VERBOSITY=generic) the body carries only the short message; ERROR_VERBOSITY=full
+// adds the underlying detail, which is useful in development but may leak internals.
+func writeError(w http.ResponseWriter, err error) {
+	var he *httpError
+	if !errors.As(err, &he) {
+		he = &httpError{Status: http.StatusInternalServerError, Message: "Internal server error", Err: err}
+	}
+	if he.Status < http.StatusInternalServerError {
+		http.Error(w, he.Message, he.Status)
+		return
+	}
+
+	id := errorID()
+	log.Printf("Error %s: %v", id, he)
+	msg := he.Message
+	if os.Getenv("ERROR_VERBOSITY") == "full" {
+		msg = he.Error()
+	}
+	w.Header().Set("X-Error-ID", id)
+	http.Error(w, fmt.Sprintf("%s (error id %s)", msg, id), he.Status)
+}
+
+// errorID returns a short random identifier correlating an error response with its log entry.
+func errorID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// candidates is the filtered, ranked restaurant set for a request.
+type candidates struct {
+	Area        searchArea
+	Filters     Filters
+	Query       string       // free text left over after filters were extracted
+	Weights     scoreWeights // score weights after the request's preferences
+	Restaurants []Restaurant
+	Warnings    []string       // non-fatal problems to report to the client
+	Location    *time.Location // the area's time zone, for time-based features
+	Sort        string         // the sort mode used, after defaults
+	FetchedAt   time.Time      // when the provider data was fetched; older than now when cached
+	Suggestion  string         // a close cuisine from the data when the requested one matched nothing
+}
+
+// dataAge returns how old c's provider data is, in whole seconds.
+func (c *candidates) dataAge() int {
+	return int(time.Since(c.FetchedAt).Seconds())
+}
+
+// appliedFilters summarizes the filters and sort order that shaped c, including those
+// inferred from the query or filled in from configuration.
+func (c *candidates) appliedFilters() map[string]interface{} {
+	applied := c.Filters.applied()
+	applied["sort"] = c.Sort
+	return applied
+}
+
+// findCandidates resolves the search area for reqData, fetches restaurants there, and
+// applies the requested and query-derived filters and sort order. It is shared by the
+// chat and list endpoints so both see the same candidates.
+func findCandidates(ctx context.Context, reqData RequestBody) (*candidates, error) {
+	if !validUnits(reqData.Units) {
+		return nil, badRequest(`units must be "mi" or "km"`)
+	}
+	if err := checkFieldLengths(reqData); err != nil {
+		return nil, err
+	}
+	weights, err := resolveWeights(reqData.Preferences, reqData.Family)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	query, err := screenQuery(effectiveQuery(reqData.Query))
+	if err != nil {
+		return nil, err
+	}
+
+	area, err := resolveSearchArea(ctx, reqData)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	origin, err := resolveOrigin(reqData)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+
+	var warnings []string
+	restaurants, fetchedAt, err := fetchRestaurants(ctx, area)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && os.Getenv("PROVIDER_TIMEOUT_MODE") == "degrade":
+		log.Printf("Restaurant provider timed out for %q, continuing without results", area.Name)
+		warnings = append(warnings, "restaurant provider timed out; results may be incomplete")
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, &httpError{Status: http.StatusGatewayTimeout, Message: "Restaurant provider timed out", Err: err}
+	case err != nil:
+		return nil, &httpError{Status: http.StatusInternalServerError, Message: "Error fetching restaurant data", Err: err}
+	case len(restaurants) == 0:
+		warnings = append(warnings, "no restaurants found for this location")
+	}
+	loc := areaLocation(area, restaurants)
+	// Search around the area, but measure from where the user actually is.
+	if origin != nil {
+		measureFrom(restaurants, *origin)
+	}
+
+	// Pull structured filters out of the free-text query; only the residual text reaches the model.
+	filters := filtersFromRequest(reqData)
+	queryFilters, residualQuery := parseQuery(query)
+	filters = filters.merge(queryFilters)
+	if filters.MinPrice == 0 && filters.MaxPrice == 0 {
+		filters = filters.merge(inferPriceIntent(query))
+	}
+
+	// Without a geocoder, distances are unknown: zero them and bypass distance filters.
+	if !geocodingEnabled() {
+		for i := range restaurants {
+			restaurants[i].Distance = 0
+		}
+		if filters.MaxDistance > 0 {
+			filters.MaxDistance = 0
+			warnings = append(warnings, "distance filter ignored: geocoding is disabled")
+		}
+	}
+	// Surprise requests skip the filters to leave room for serendipity.
+	if reqData.Surprise {
+		filters = Filters{}
+	}
+	fetched := restaurants
+	restaurants = filterRestaurants(restaurants, filters)
+	var suggestion string
+	if len(restaurants) == 0 && filters.Cuisine != "" {
+		suggestion = suggestCuisine(filters.Cuisine, fetched)
+	}
+	if err := sortRestaurants(restaurants, reqData.Sort, weights); err != nil {
+		return nil, badRequest(err.Error())
+	}
+	// Optionally make sure the top results aren't all the same cuisine.
+	restaurants = diversifyCuisines(restaurants, envInt("DIVERSITY_TOP_N", 5), envInt("DIVERSITY_MIN_CUISINES", 0))
+	// Likewise for price levels, so the top results offer a real choice of budgets.
+	restaurants = diversifyPrices(restaurants, envInt("DIVERSITY_TOP_N", 5), envInt("DIVERSITY_MIN_PRICE_LEVELS", 0))
+	// Pinned places lead the list whatever the filters say, so no budget trims them.
+	restaurants = pinRestaurants(fetched, restaurants, reqData.Pin)
+	for i := range restaurants {
+		restaurants[i].DistanceKm = milesToKm(restaurants[i].Distance)
+	}
+	annotateClosingSoon(restaurants, loc)
+
+	return &candidates{
+		Area:        area,
+		Filters:     filters,
+		Query:       residualQuery,
+		Weights:     weights,
+		Restaurants: restaurants,
+		Warnings:    warnings,
+		Location:    loc,
+		Sort:        sortMode(reqData.Sort),
+		FetchedAt:   fetchedAt,
+		Suggestion:  suggestion,
+	}, nil
+}
+
+// requestFromQuery maps /v1/restaurants query parameters onto a RequestBody, using the
+// same names as the JSON fields. Lists such as features are comma-separated.
+func requestFromQuery(q url.Values) (RequestBody, error) {
+	reqData := RequestBody{
+		Location: q.Get("location"),
+		Query:    q.Get("query"),
+		Units:    q.Get("units"),
+		Sort:     q.Get("sort"),
+		Cuisine:  q.Get("cuisine"),
+		Family:   q.Get("family") == "true",
+	}
+	if raw := q.Get("features"); raw != "" {
+		reqData.Features = strings.Split(raw, ",")
+	}
+	if raw := q.Get("pin"); raw != "" {
+		reqData.Pin = strings.Split(raw, ",")
+	}
+
+	var err error
+	if reqData.Lat, err = floatParam(q, "lat"); err != nil {
+		return RequestBody{}, err
+	}
+	if reqData.Lon, err = floatParam(q, "lon"); err != nil {
+		return RequestBody{}, err
+	}
+	if reqData.OriginLat, err = floatParam(q, "origin_lat"); err != nil {
+		return RequestBody{}, err
+	}
+	if reqData.OriginLon, err = floatParam(q, "origin_lon"); err != nil {
+		return RequestBody{}, err
+	}
+	if p, err := floatParam(q, "min_price"); err != nil {
+		return RequestBody{}, err
+	} else if p != nil {
+		reqData.MinPrice = *p
+	}
+	if p, err := floatParam(q, "max_price"); err != nil {
+		return RequestBody{}, err
+	} else if p != nil {
+		reqData.MaxPrice = *p
+	}
+	if raw := q.Get("shuffle_seed"); raw != "" {
+		seed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return RequestBody{}, badRequest("invalid shuffle_seed")
+		}
+		reqData.ShuffleSeed = &seed
+	}
+	if raw := q.Get("max_wait"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return RequestBody{}, badRequest("invalid max_wait")
+		}
+		reqData.MaxWait = &n
+	}
+	return reqData, nil
+}
+
+// floatParam parses the optional numeric query parameter name, returning nil when it is absent.
+func floatParam(q url.Values, name string) (*float64, error) {
+	raw := q.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, badRequest("invalid " + name)
+	}
+	return &f, nil
+}
+
+// handleRestaurants serves GET /v1/restaurants: the filtered, ranked restaurant list
+// without an AI recommendation. The format query parameter selects "json" (default), "csv",
+// "geojson" or "stats" (aggregates over every match, ignoring paging); explain=true adds a
+// reason to each restaurant in the JSON format. The limit and offset parameters page the
+// list; the X-Total-Count header and the JSON total_matches field give the number of
+// matches before paging. Pinned places that fail the filters are listed but are not
+// matches, so neither counts nor stats include them; the JSON pinned_unmatched field
+// gives their number.
+func handleRestaurants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reqData, err := requestFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	found, err := findCandidates(r.Context(), reqData)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Page the results after filtering so total_matches reflects every match. Pinned places
+	// that failed the filters are listed but not counted as matches. A shuffle seed
+	// reorders the whole list first, so pages stay consistent for the same seed.
+	all := shuffleRestaurants(found.Restaurants, reqData.ShuffleSeed)
+	total := len(filterMatches(all))
+	page, err := pageRestaurants(all, r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	found.Restaurants = page
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if r.URL.Query().Get("explain") == "true" {
+		for i := range found.Restaurants {
+			found.Restaurants[i].Reason = explainRank(found.Restaurants[i], found.Weights)
+		}
+	}
+
+	// The ETag covers the data, not data_age_seconds, so a repeat request served from the
+	// restaurant cache costs no rendering.
+	format := r.URL.Query().Get("format")
+	etag := restaurantsETag(format, found, all)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	switch format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		response := map[string]interface{}{
+			"restaurants":      found.Restaurants,
+			"total_matches":    total,
+			"applied_filters":  found.appliedFilters(),
+			"data_age_seconds": found.dataAge(),
+		}
+		if extra := len(all) - total; extra > 0 {
+			response["pinned_unmatched"] = extra
+		}
+		if len(found.Warnings) > 0 {
+			response["warnings"] = found.Warnings
+		}
+		if nearest := nearestRestaurant(all); nearest != nil {
+			response["nearest"] = nearest
+		}
+		if found.Suggestion != "" {
+			response["suggestion"] = map[string]string{"cuisine": found.Suggestion}
+		}
+		json.NewEncoder(w).Encode(response)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="restaurants.csv"`)
+		writeRestaurantsCSV(w, found.Restaurants)
+	case "geojson":
+		w.Header().Set("Content-Type", "application/geo+json")
+		json.NewEncoder(w).Encode(restaurantsGeoJSON(found.Restaurants))
+	case "stats":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(restaurantStats(filterMatches(all)))
+	default:
+		http.Error(w, "format must be json, csv, geojson or stats", http.StatusBadRequest)
+	}
+}
+
+// restaurantsETag returns a weak ETag for the list response in format: a hash of the page,
+// the full match list, filters and warnings. It is weak because the response's
+// data_age_seconds keeps changing while the data doesn't.
+func restaurantsETag(format string, found *candidates, all []Restaurant) string {
+	data, err := json.Marshal(struct {
+		Format   string
+		Page     []Restaurant
+		All      []Restaurant
+		Filters  map[string]interface{}
+		Warnings []string
+	}{format, found.Restaurants, all, found.appliedFilters(), found.Warnings})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag, using the weak
+// comparison that If-None-Match calls for.
+func etagMatches(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// pageRestaurants applies the optional offset and limit query parameters to restaurants.
+func pageRestaurants(restaurants []Restaurant, q url.Values) ([]Restaurant, error) {
+	offset, limit := 0, 0
+	var err error
+	if raw := q.Get("offset"); raw != "" {
+		if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+			return nil, badRequest("invalid offset")
+		}
+	}
+	if raw := q.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+			return nil, badRequest("invalid limit")
+		}
+	}
+	if offset >= len(restaurants) {
+		return []Restaurant{}, nil
+	}
+	restaurants = restaurants[offset:]
+	if limit > 0 && len(restaurants) > limit {
+		restaurants = restaurants[:limit]
+	}
+	return restaurants, nil
+}
+
+// restaurantCSVHeader lists the scalar Restaurant fields exported as CSV. Reviews are omitted.
+var restaurantCSVHeader = []string{
+	"name", "cuisine", "address", "price", "rating", "distance", "distance_km", "wait_minutes", "features",
+}
+
+// writeRestaurantsCSV writes a header row plus one row per restaurant.
+func writeRestaurantsCSV(w http.ResponseWriter, restaurants []Restaurant) {
+	cw := csv.NewWriter(w)
+	cw.Write(restaurantCSVHeader)
+	for _, r := range restaurants {
+		wait := ""
+		if r.WaitMinutes != nil {
+			wait = strconv.Itoa(*r.WaitMinutes)
+		}
+		cw.Write([]string{
+			r.Name,
+			r.Cuisine,
+			r.Address,
+			strconv.FormatFloat(r.Price, 'f', 2, 64),
+			strconv.FormatFloat(r.Rating, 'f', 1, 64),
+			strconv.FormatFloat(r.Distance, 'f', 2, 64),
+			strconv.FormatFloat(r.DistanceKm, 'f', 2, 64),
+			wait,
+			strings.Join(r.Features, ";"),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Writing CSV failed: %v", err)
+	}
+}
+
+// restaurantsGeoJSON builds a GeoJSON FeatureCollection with one Point feature per restaurant.
+// Restaurants without coordinates are left out, since a feature needs a geometry to be mapped.
+func restaurantsGeoJSON(restaurants []Restaurant) map[string]interface{} {
+	features := make([]map[string]interface{}, 0, len(restaurants))
+	for _, r := range restaurants {
+		if r.Lat == 0 && r.Lon == 0 {
+			continue
+		}
+		features = append(features, map[string]interface{}{
+			"type": "Feature",
+			"geometry": map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []float64{r.Lon, r.Lat}, // GeoJSON order is longitude, latitude
+			},
+			"properties": map[string]interface{}{
+				"name":    r.Name,
+				"rating":  r.Rating,
+				"price":   r.Price,
+				"address": r.Address,
+			},
+		})
+	}
+	return map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": features,
+	}
+}
+
+// priceTier buckets a price into "$" (under $15), "$$" (under $40) or "$$$", matching the
+// bands priceLabel describes.
+func priceTier(price float64) string {
+	switch {
+	case price < 15:
+		return "$"
+	case price < 40:
+		return "$$"
+	default:
+		return "$$$"
+	}
+}
+
+// restaurantStats summarizes restaurants: their count, the average, minimum and maximum
+// price and rating, and how many fall into each price tier.
+func restaurantStats(restaurants []Restaurant) map[string]interface{} {
+	histogram := map[string]int{"$": 0, "$$": 0, "$$$": 0}
+	stats := map[string]interface{}{"count": len(restaurants), "price_histogram": histogram}
+	if len(restaurants) == 0 {
+		return stats
+	}
+
+	price := map[string]float64{"min": restaurants[0].Price, "max": restaurants[0].Price}
+	rating := map[string]float64{"min": restaurants[0].Rating, "max": restaurants[0].Rating}
+	var priceSum, ratingSum float64
+	for _, r := range restaurants {
+		priceSum += r.Price
+		ratingSum += r.Rating
+		price["min"], price["max"] = math.Min(price["min"], r.Price), math.Max(price["max"], r.Price)
+		rating["min"], rating["max"] = math.Min(rating["min"], r.Rating), math.Max(rating["max"], r.Rating)
+		histogram[priceTier(r.Price)]++
+	}
+	n := float64(len(restaurants))
+	price["avg"] = priceSum / n
+	rating["avg"] = ratingSum / n
+	stats["price"] = price
+	stats["rating"] = rating
+	return stats
+}
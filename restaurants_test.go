@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// getRestaurantList sends GET /v1/restaurants with query to handleRestaurants.
+func getRestaurantList(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleRestaurants(rec, httptest.NewRequest(http.MethodGet, "/v1/restaurants?"+query, nil))
+	return rec
+}
+
+// listedRestaurants returns the restaurants of a JSON list response.
+func listedRestaurants(t *testing.T, rec *httptest.ResponseRecorder) []map[string]interface{} {
+	t.Helper()
+	resp := decodeJSON(t, rec)
+	list, _ := resp["restaurants"].([]interface{})
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, r := range list {
+		out = append(out, r.(map[string]interface{}))
+	}
+	return out
+}
+
+func TestListIncludesKilometers(t *testing.T) {
+	rec := getRestaurantList(t, "location=San+Francisco&units=km")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	for _, r := range listedRestaurants(t, rec) {
+		miles, km := r["distance"].(float64), r["distance_km"].(float64)
+		if diff := km - milesToKm(miles); diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: distance_km %v does not match distance %v miles", r["name"], km, miles)
+		}
+	}
+
+	if rec := getRestaurantList(t, "location=San+Francisco&units=yd"); rec.Code != http.StatusBadRequest {
+		t.Errorf("units=yd: status %d, want 400", rec.Code)
+	}
+}
+
+func TestListAsCSV(t *testing.T) {
+	rec := getRestaurantList(t, "location=San+Francisco&format=csv&sort=name")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+		t.Errorf("Content-Disposition = %q, want an attachment", cd)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("body is not CSV: %v", err)
+	}
+	if !reflect.DeepEqual(rows[0], restaurantCSVHeader) {
+		t.Errorf("header row = %v, want %v", rows[0], restaurantCSVHeader)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want a header and three restaurants", len(rows))
+	}
+	want := []string{"Budget Bites", "italian", "456 Elm St", "15.00", "4.0", "0.80", "1.29", "5", "accepts_cards;delivery;kid_friendly"}
+	if !reflect.DeepEqual(rows[1], want) {
+		t.Errorf("first row = %v, want %v", rows[1], want)
+	}
+}
+
+func TestListAsGeoJSON(t *testing.T) {
+	rec := getRestaurantList(t, "location=San+Francisco&format=geojson")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/geo+json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	resp := decodeJSON(t, rec)
+	if resp["type"] != "FeatureCollection" {
+		t.Errorf("type = %v, want FeatureCollection", resp["type"])
+	}
+	features, _ := resp["features"].([]interface{})
+	if len(features) != 3 {
+		t.Fatalf("got %d features, want 3", len(features))
+	}
+	for _, f := range features {
+		feature := f.(map[string]interface{})
+		geometry := feature["geometry"].(map[string]interface{})
+		coords, _ := geometry["coordinates"].([]interface{})
+		if feature["type"] != "Feature" || geometry["type"] != "Point" || len(coords) != 2 {
+			t.Errorf("feature = %v, want a Point with coordinates", feature)
+			continue
+		}
+		if lon := coords[0].(float64); lon > -122 || lon < -123 {
+			t.Errorf("coordinates %v are not longitude first", coords)
+		}
+		props := feature["properties"].(map[string]interface{})
+		for _, key := range []string{"name", "rating", "price", "address"} {
+			if _, ok := props[key]; !ok {
+				t.Errorf("properties lack %q: %v", key, props)
+			}
+		}
+	}
+}
+
+func TestGeoJSONSkipsRestaurantsWithoutCoordinates(t *testing.T) {
+	fc := restaurantsGeoJSON([]Restaurant{{Name: "Nowhere"}, {Name: "Somewhere", Lat: 1, Lon: 2}})
+	if features := fc["features"].([]map[string]interface{}); len(features) != 1 {
+		t.Errorf("got %d features, want only the one with coordinates", len(features))
+	}
+}
+
+func TestListExplainIsOptIn(t *testing.T) {
+	for _, r := range listedRestaurants(t, getRestaurantList(t, "location=San+Francisco")) {
+		if _, ok := r["reason"]; ok {
+			t.Errorf("%s has a reason without explain=true", r["name"])
+		}
+	}
+	for _, r := range listedRestaurants(t, getRestaurantList(t, "location=San+Francisco&explain=true")) {
+		if reason, _ := r["reason"].(string); reason == "" {
+			t.Errorf("%s has no reason with explain=true", r["name"])
+		}
+	}
+}
+
+func TestListTotalMatchesIgnoresLimit(t *testing.T) {
+	rec := getRestaurantList(t, "location=San+Francisco&limit=1&offset=1&sort=name")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("X-Total-Count"); got != "3" {
+		t.Errorf("X-Total-Count = %q, want 3", got)
+	}
+	resp := decodeJSON(t, rec)
+	if resp["total_matches"] != 3.0 {
+		t.Errorf("total_matches = %v, want 3", resp["total_matches"])
+	}
+	if list, _ := resp["restaurants"].([]interface{}); len(list) != 1 || list[0].(map[string]interface{})["name"] != "Fancy Eats" {
+		t.Errorf("restaurants = %v, want only the second by name", resp["restaurants"])
+	}
+
+	rec = getRestaurantList(t, "location=San+Francisco&max_price=30&limit=1")
+	if got := rec.Header().Get("X-Total-Count"); got != "2" {
+		t.Errorf("filtered X-Total-Count = %q, want 2", got)
+	}
+	if rec := getRestaurantList(t, "location=San+Francisco&limit=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: status %d, want 400", rec.Code)
+	}
+}
+
+func TestListTotalMatchesSkipsUnmatchedPins(t *testing.T) {
+	rec := getRestaurantList(t, "location=San+Francisco&cuisine=french&pin=Budget%20Bites")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("X-Total-Count"); got != "1" {
+		t.Errorf("X-Total-Count = %q, want 1", got)
+	}
+	resp := decodeJSON(t, rec)
+	if resp["total_matches"] != 1.0 || resp["pinned_unmatched"] != 1.0 {
+		t.Errorf("total_matches = %v, pinned_unmatched = %v, want 1 and 1", resp["total_matches"], resp["pinned_unmatched"])
+	}
+	if list, _ := resp["restaurants"].([]interface{}); len(list) != 2 {
+		t.Errorf("restaurants = %v, want the pinned place listed with the match", resp["restaurants"])
+	}
+	if _, ok := decodeJSON(t, getRestaurantList(t, "location=San+Francisco&cuisine=french"))["pinned_unmatched"]; ok {
+		t.Error("pinned_unmatched reported without pins")
+	}
+}
+
+func TestErrorVerbosity(t *testing.T) {
+	internal := &httpError{Status: http.StatusBadGateway, Message: "Error calling Ollama", Err: errors.New("dial tcp 10.0.0.7:11434: connection refused")}
+	write := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		writeError(rec, internal)
+		return rec
+	}
+
+	logs := captureLogs(t)
+	rec := write()
+	id := rec.Header().Get("X-Error-ID")
+	if id == "" {
+		t.Fatal("no X-Error-ID header")
+	}
+	if body := rec.Body.String(); body != "Error calling Ollama (error id "+id+")\n" {
+		t.Errorf("generic body = %q", body)
+	}
+	if !strings.Contains(logs.String(), id) || !strings.Contains(logs.String(), "connection refused") {
+		t.Errorf("log lacks the detail under the error id:\n%s", logs)
+	}
+
+	t.Setenv("ERROR_VERBOSITY", "full")
+	rec = write()
+	if body := rec.Body.String(); !strings.Contains(body, "connection refused") || !strings.Contains(body, rec.Header().Get("X-Error-ID")) {
+		t.Errorf("full body = %q, want the detail and error id", body)
+	}
+
+	rec = httptest.NewRecorder()
+	writeError(rec, badRequest("invalid limit"))
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("X-Error-ID") != "" {
+		t.Errorf("client error = %d with id %q, want a plain 400", rec.Code, rec.Header().Get("X-Error-ID"))
+	}
+}
+
+func TestRestaurantStats(t *testing.T) {
+	stats := restaurantStats([]Restaurant{
+		{Price: 10, Rating: 3.5}, {Price: 20, Rating: 4.5}, {Price: 30, Rating: 4.0}, {Price: 60, Rating: 5.0},
+	})
+	if stats["count"] != 4 {
+		t.Errorf("count = %v, want 4", stats["count"])
+	}
+	if want := map[string]float64{"min": 10, "max": 60, "avg": 30}; !reflect.DeepEqual(stats["price"], want) {
+		t.Errorf("price = %v, want %v", stats["price"], want)
+	}
+	if want := map[string]float64{"min": 3.5, "max": 5, "avg": 4.25}; !reflect.DeepEqual(stats["rating"], want) {
+		t.Errorf("rating = %v, want %v", stats["rating"], want)
+	}
+	if want := map[string]int{"$": 1, "$$": 2, "$$$": 1}; !reflect.DeepEqual(stats["price_histogram"], want) {
+		t.Errorf("price_histogram = %v, want %v", stats["price_histogram"], want)
+	}
+
+	empty := restaurantStats(nil)
+	if empty["count"] != 0 || empty["price"] != nil {
+		t.Errorf("empty stats = %v, want a zero count only", empty)
+	}
+}
+
+func TestListAsStatsIgnoresPaging(t *testing.T) {
+	rec := getRestaurantList(t, "location=San+Francisco&format=stats&limit=1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	resp := decodeJSON(t, rec)
+	if resp["count"] != 3.0 {
+		t.Errorf("count = %v, want all 3 matches", resp["count"])
+	}
+	if want := map[string]interface{}{"$": 0.0, "$$": 2.0, "$$$": 1.0}; !reflect.DeepEqual(resp["price_histogram"], want) {
+		t.Errorf("price_histogram = %v, want %v", resp["price_histogram"], want)
+	}
+}
+
+func TestListStatsSkipUnmatchedPins(t *testing.T) {
+	plain := decodeJSON(t, getRestaurantList(t, "location=San+Francisco&cuisine=french&format=stats"))
+	pinned := decodeJSON(t, getRestaurantList(t, "location=San+Francisco&cuisine=french&pin=Budget%20Bites&format=stats"))
+	if pinned["count"] != 1.0 || !reflect.DeepEqual(pinned, plain) {
+		t.Errorf("stats with a pin = %v, want the unpinned %v", pinned, plain)
+	}
+}
+
+func TestListETag(t *testing.T) {
+	first := getRestaurantList(t, "location=San+Francisco")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("first request: status %d, ETag %q, want 200 with a weak ETag", first.Code, etag)
+	}
+
+	conditional := func(query, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/restaurants?"+query, nil)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		rec := httptest.NewRecorder()
+		handleRestaurants(rec, req)
+		return rec
+	}
+	rec := conditional("location=San+Francisco", etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("matching If-None-Match: status %d with %d body bytes, want an empty 304", rec.Code, rec.Body.Len())
+	}
+	if rec := conditional("location=San+Francisco", `"other", `+strings.TrimPrefix(etag, "W/")); rec.Code != http.StatusNotModified {
+		t.Errorf("weak match in a list: status %d, want 304", rec.Code)
+	}
+	if rec := conditional("location=San+Francisco&sort=name", etag); rec.Code != http.StatusOK {
+		t.Errorf("different result: status %d, want 200", rec.Code)
+	}
+	if rec := conditional("location=San+Francisco&format=csv", etag); rec.Code != http.StatusOK {
+		t.Errorf("different format: status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// retryBudget limits the retries made on behalf of one request across all stages, so
+// independent retries in the provider fetch and the Ollama call can't compound into a
+// long stall. A zero limit means unlimited.
+type retryBudget struct {
+	mu          sync.Mutex
+	maxAttempts int
+	maxTime     time.Duration
+	attempts    int
+	spent       time.Duration
+}
+
+type retryBudgetKey struct{}
+
+// startRetry reports whether stage may retry under the budget carried by ctx and, if so,
+// charges one attempt and returns a function to call when the retry finishes, which charges
+// the time it took. Without a budget in ctx every retry is allowed.
+func startRetry(ctx context.Context, stage string) (func(), bool) {
+	b, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if !ok {
+		return func() {}, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if (b.maxAttempts > 0 && b.attempts >= b.maxAttempts) || (b.maxTime > 0 && b.spent >= b.maxTime) {
+		log.Printf("Retry budget exhausted (%d attempts, %s), not retrying %s", b.attempts, b.spent.Round(time.Millisecond), stage)
+		return nil, false
+	}
+	b.attempts++
+	start := time.Now()
+	return func() {
+		b.mu.Lock()
+		b.spent += time.Since(start)
+		b.mu.Unlock()
+	}, true
+}
+
+// retryBudgetMiddleware gives each request a retry budget of at most RETRY_BUDGET attempts
+// and RETRY_BUDGET_TIME spent retrying (both unlimited by default). Once either runs out,
+// later failures in any stage are returned without retrying.
+func retryBudgetMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget := &retryBudget{
+			maxAttempts: envInt("RETRY_BUDGET", 0),
+			maxTime:     envDuration("RETRY_BUDGET_TIME", 0),
+		}
+		r = r.WithContext(context.WithValue(r.Context(), retryBudgetKey{}, budget))
+		next.ServeHTTP(w, r)
+	})
+}
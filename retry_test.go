@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartRetryChargesTheBudget(t *testing.T) {
+	if _, ok := startRetry(context.Background(), "test"); !ok {
+		t.Error("retry refused without a budget")
+	}
+
+	b := &retryBudget{maxAttempts: 2}
+	ctx := context.WithValue(context.Background(), retryBudgetKey{}, b)
+	for i := 0; i < 2; i++ {
+		done, ok := startRetry(ctx, "test")
+		if !ok {
+			t.Fatalf("retry %d refused within the budget", i)
+		}
+		done()
+	}
+	if _, ok := startRetry(ctx, "test"); ok {
+		t.Error("third retry allowed with RETRY_BUDGET=2")
+	}
+
+	timed := &retryBudget{maxTime: 10 * time.Millisecond}
+	ctx = context.WithValue(context.Background(), retryBudgetKey{}, timed)
+	done, _ := startRetry(ctx, "test")
+	time.Sleep(15 * time.Millisecond)
+	done()
+	if _, ok := startRetry(ctx, "test"); ok {
+		t.Error("retry allowed after the time budget was spent")
+	}
+}
+
+// retryingStages makes the provider return nothing the first time and the primary model
+// fail, so a request wants one retry in each stage. It returns the Ollama stub.
+func retryingStages(t *testing.T) *ollamaStub {
+	t.Helper()
+	t.Setenv("EMPTY_RESULT_RETRY", "true")
+	t.Setenv("EMPTY_RESULT_RETRY_DELAY", "1ms")
+	t.Setenv("FALLBACK_MODEL", "small")
+	t.Setenv("OLLAMA_MODEL", "big")
+	fetched := false
+	setProvider(t, func(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+		if !fetched {
+			fetched = true
+			return nil, nil
+		}
+		return []Restaurant{{Name: "Budget Bites", Rating: 4}, {Name: "Fancy Eats", Rating: 4.7}}, nil
+	})
+	return newOllamaStub(t, func(w http.ResponseWriter, req ChatRequest) {
+		if req.Model == "big" {
+			notFound(w, req)
+			return
+		}
+		writeChatReply(w, req.Model, "Try Fancy Eats.")
+	})
+}
+
+// postWithBudget sends body through retryBudgetMiddleware to handleRequest.
+func postWithBudget(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	retryBudgetMiddleware(http.HandlerFunc(handleRequest)).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRetryBudgetIsSharedAcrossStages(t *testing.T) {
+	t.Setenv("RETRY_BUDGET", "1")
+	stub := retryingStages(t)
+	rec := postWithBudget(t, `{"location": "San Francisco"}`)
+	if rec.Code == http.StatusOK {
+		t.Fatalf("status 200, want the Ollama failure once the provider retry spent the budget")
+	}
+	if got := stub.received(); len(got) != 1 || got[0].Model != "big" {
+		t.Errorf("Ollama received %d requests, want only the primary model", len(got))
+	}
+}
+
+func TestRetryBudgetAllowsEachStage(t *testing.T) {
+	t.Setenv("RETRY_BUDGET", "2")
+	stub := retryingStages(t)
+	rec := postWithBudget(t, `{"location": "San Francisco"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got := stub.received(); len(got) != 2 || got[1].Model != "small" {
+		t.Errorf("Ollama received %d requests, want the primary then the fallback", len(got))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Review is a single customer review.
+type Review struct {
+	Text string    `json:"text"`
+	Date time.Time `json:"date,omitzero"` // when the review was written; zero when unknown
+}
+
+// UnmarshalJSON accepts either a review object or, for backward compatibility,
+// a plain string holding just the review text.
+func (r *Review) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*r = Review{Text: text}
+		return nil
+	}
+	type plain Review // avoids recursing into this method
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*r = Review(p)
+	return nil
+}
+
+// reviewTexts returns just the text of each review.
+func reviewTexts(reviews []Review) []string {
+	texts := make([]string, len(reviews))
+	for i, r := range reviews {
+		texts[i] = r.Text
+	}
+	return texts
+}
+
+// dropSharedReviews removes reviews whose text appears on at least threshold different
+// restaurants, since scraped data sometimes attaches the same boilerplate ("Great food!")
+// to many places. Texts are compared ignoring case, punctuation and spacing. A threshold
+// below 2 disables the pass. Review slices are copied, never modified in place.
+func dropSharedReviews(restaurants []Restaurant, threshold int) {
+	if threshold < 2 {
+		return
+	}
+	counts := make(map[string]int)
+	for _, r := range restaurants {
+		seen := make(map[string]bool)
+		for _, rev := range r.Reviews {
+			key := reviewKey(rev.Text)
+			if !seen[key] {
+				seen[key] = true
+				counts[key]++
+			}
+		}
+	}
+	for i, r := range restaurants {
+		var kept []Review
+		for _, rev := range r.Reviews {
+			if counts[reviewKey(rev.Text)] < threshold {
+				kept = append(kept, rev)
+			}
+		}
+		restaurants[i].Reviews = kept
+	}
+}
+
+// reviewKey normalizes review text for duplicate detection.
+func reviewKey(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// recentReviews returns up to limit reviews, newest first. Undated reviews sort last.
+// A limit of zero or less keeps them all.
+func recentReviews(reviews []Review, limit int) []Review {
+	sorted := append([]Review(nil), reviews...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Date, sorted[j].Date
+		if a.IsZero() != b.IsZero() {
+			return b.IsZero()
+		}
+		return a.After(b)
+	})
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+// timeAgo describes how long before ref t was, e.g. "3 days ago" or "2 months ago".
+func timeAgo(t, ref time.Time) string {
+	days := int(ref.Sub(t).Hours() / 24)
+	switch {
+	case days < 1:
+		return "today"
+	case days < 14:
+		return plural(days, "day") + " ago"
+	case days < 60:
+		return plural(days/7, "week") + " ago"
+	case days < 730:
+		return plural(days/30, "month") + " ago"
+	default:
+		return plural(days/365, "year") + " ago"
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// formatReviews renders reviews for the prompt, newest first and annotated with their
+// age so the model can weigh recent experiences more heavily.
+func formatReviews(reviews []Review, limit int) string {
+	var parts []string
+	for _, r := range recentReviews(reviews, limit) {
+		if r.Date.IsZero() {
+			parts = append(parts, fmt.Sprintf("%q", r.Text))
+		} else {
+			parts = append(parts, fmt.Sprintf("%q (%s)", r.Text, timeAgo(r.Date, now())))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// daysAgo returns the time n days before now, for populating sample review dates.
+func daysAgo(n int) time.Time {
+	return now().AddDate(0, 0, -n).Truncate(24 * time.Hour)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReviewUnmarshalAcceptsStringsAndObjects(t *testing.T) {
+	var reviews []Review
+	data := `["Great food!", {"text": "Slow service.", "date": "2024-04-01T00:00:00Z"}]`
+	if err := json.Unmarshal([]byte(data), &reviews); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := []Review{
+		{Text: "Great food!"},
+		{Text: "Slow service.", Date: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(reviews, want) {
+		t.Errorf("reviews = %+v, want %+v", reviews, want)
+	}
+	if err := json.Unmarshal([]byte(`[42]`), &reviews); err == nil {
+		t.Error("Unmarshal accepted a number as a review")
+	}
+
+	out, err := json.Marshal(Review{Text: "Great food!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"text":"Great food!"}` {
+		t.Errorf("undated review marshals as %s, want no date", out)
+	}
+}
+
+func TestRecentReviewsNewestFirst(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	reviews := []Review{{Text: "old", Date: day(1)}, {Text: "undated"}, {Text: "newest", Date: day(20)}, {Text: "mid", Date: day(10)}}
+
+	got := reviewTexts(recentReviews(reviews, 0))
+	if want := []string{"newest", "mid", "old", "undated"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+	if got := reviewTexts(recentReviews(reviews, 2)); !reflect.DeepEqual(got, []string{"newest", "mid"}) {
+		t.Errorf("limited to 2 = %v, want the two newest", got)
+	}
+	if reviews[0].Text != "old" {
+		t.Error("recentReviews reordered its input")
+	}
+}
+
+func TestFormatReviewsNotesRecency(t *testing.T) {
+	setClock(t, time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC))
+	reviews := []Review{
+		{Text: "Old favorite.", Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{Text: "Just went!", Date: time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{Text: "No date."},
+	}
+	got := formatReviews(reviews, 3)
+	if want := `"Just went!" (3 days ago); "Old favorite." (3 months ago); "No date."`; got != want {
+		t.Errorf("formatReviews = %s, want %s", got, want)
+	}
+}
+
+func TestTimeAgo(t *testing.T) {
+	ref := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+	tests := map[int]string{0: "today", 1: "1 day ago", 13: "13 days ago", 20: "2 weeks ago", 90: "3 months ago", 800: "2 years ago"}
+	for days, want := range tests {
+		if got := timeAgo(ref.AddDate(0, 0, -days), ref); got != want {
+			t.Errorf("timeAgo(%d days) = %q, want %q", days, got, want)
+		}
+	}
+}
+
+func TestDropSharedReviews(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "A", Reviews: []Review{{Text: "Great food!"}, {Text: "The gnocchi is superb."}}},
+		{Name: "B", Reviews: []Review{{Text: "great   food"}, {Text: "Great food!"}}},
+		{Name: "C", Reviews: []Review{{Text: "GREAT FOOD."}, {Text: "Loud on weekends."}}},
+		{Name: "D", Reviews: []Review{{Text: "Loud on weekends!"}}},
+	}
+	original := restaurants[0].Reviews
+	dropSharedReviews(restaurants, 3)
+
+	want := map[string][]string{
+		"A": {"The gnocchi is superb."},
+		"B": {},
+		"C": {"Loud on weekends."},
+		"D": {"Loud on weekends!"},
+	}
+	for _, r := range restaurants {
+		if got := reviewTexts(r.Reviews); !reflect.DeepEqual(got, want[r.Name]) {
+			t.Errorf("%s reviews = %q, want %q", r.Name, got, want[r.Name])
+		}
+	}
+	if original[0].Text != "Great food!" {
+		t.Error("dropSharedReviews modified the input reviews")
+	}
+
+	kept := []Restaurant{{Reviews: []Review{{Text: "Great food!"}}}, {Reviews: []Review{{Text: "Great food!"}}}}
+	dropSharedReviews(kept, 0)
+	if len(kept[0].Reviews) != 1 {
+		t.Error("threshold 0 dropped reviews")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// safetyRefusal replaces a model reply that trips the safety filter in reject mode.
+const safetyRefusal = "Sorry, I can't share that recommendation. Please try a different request."
+
+// safetyMode returns the configured SAFETY_FILTER mode: "mask", "reject" or "" (off, the default).
+func safetyMode() string {
+	switch mode := os.Getenv("SAFETY_FILTER"); mode {
+	case "mask", "reject":
+		return mode
+	default:
+		return ""
+	}
+}
+
+// safetyPattern matches any word in the comma-separated SAFETY_WORDS list as a whole word,
+// case-insensitively. It returns nil when the list is empty.
+func safetyPattern() *regexp.Regexp {
+	var words []string
+	for _, w := range strings.Split(os.Getenv("SAFETY_WORDS"), ",") {
+		if w = strings.TrimSpace(w); w != "" {
+			words = append(words, regexp.QuoteMeta(w))
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(words, "|") + `)\b`)
+}
+
+// maskWords replaces each match of pattern in s with asterisks of the same length.
+func maskWords(s string, pattern *regexp.Regexp) string {
+	return pattern.ReplaceAllStringFunc(s, func(m string) string {
+		return strings.Repeat("*", len([]rune(m)))
+	})
+}
+
+// screenQuery applies the safety filter to a user query: in mask mode listed words are
+// masked, in reject mode a query containing one is a bad request.
+func screenQuery(q string) (string, error) {
+	mode, pattern := safetyMode(), safetyPattern()
+	if mode == "" || pattern == nil || !pattern.MatchString(q) {
+		return q, nil
+	}
+	if mode == "reject" {
+		return "", badRequest("query contains disallowed words")
+	}
+	return maskWords(q, pattern), nil
+}
+
+// screenResult applies the safety filter to every piece of model-generated text in res: the
+// reply, its reasoning, the structured pick, alternatives, translations, tool call arguments
+// and the raw debug reply. In mask mode listed words are masked wherever they appear; in
+// reject mode a listed word anywhere replaces the whole reply with safetyRefusal and drops
+// the rest of the generated text.
+func screenResult(res *chatResult) {
+	mode, pattern := safetyMode(), safetyPattern()
+	if mode == "" || pattern == nil {
+		return
+	}
+	if mode == "mask" {
+		eachModelText(res, func(s string) string { return maskWords(s, pattern) })
+		return
+	}
+	tripped := false
+	eachModelText(res, func(s string) string {
+		tripped = tripped || pattern.MatchString(s)
+		return s
+	})
+	if !tripped {
+		return
+	}
+	res.Content = safetyRefusal
+	res.Reasoning = ""
+	res.ToolCalls = nil
+	res.Recommendation = nil
+	res.LowConfidence = false
+	res.Alternatives = []Alternative{}
+	for lang := range res.Translations {
+		res.Translations[lang] = safetyRefusal
+	}
+	res.RawOllama = ""
+}
+
+// eachModelText replaces each piece of model-generated text in res with f applied to it.
+func eachModelText(res *chatResult, f func(string) string) {
+	res.Content = f(res.Content)
+	res.Reasoning = f(res.Reasoning)
+	res.RawOllama = f(res.RawOllama)
+	if res.Recommendation != nil {
+		rec := *res.Recommendation
+		rec.Name, rec.Reason = f(rec.Name), f(rec.Reason)
+		res.Recommendation = &rec
+	}
+	for i := range res.Alternatives {
+		res.Alternatives[i].Name = f(res.Alternatives[i].Name)
+		res.Alternatives[i].Reason = f(res.Alternatives[i].Reason)
+	}
+	for lang, text := range res.Translations {
+		res.Translations[lang] = f(text)
+	}
+	for i := range res.ToolCalls {
+		res.ToolCalls[i].Function.Arguments = mapJSONStrings(res.ToolCalls[i].Function.Arguments, f)
+	}
+}
+
+// mapJSONStrings applies f to every string value in the JSON document raw, leaving keys
+// and structure alone. Invalid JSON is returned unchanged.
+func mapJSONStrings(raw json.RawMessage, f func(string) string) json.RawMessage {
+	var v interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &v) != nil {
+		return raw
+	}
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case string:
+			return f(v)
+		case []interface{}:
+			for i := range v {
+				v[i] = walk(v[i])
+			}
+		case map[string]interface{}:
+			for k := range v {
+				v[k] = walk(v[k])
+			}
+		}
+		return v
+	}
+	out, err := json.Marshal(walk(v))
+	if err != nil {
+		return raw
+	}
+	return out
+}
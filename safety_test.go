@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestScreenQuery(t *testing.T) {
+	t.Setenv("SAFETY_WORDS", "darn, heck")
+	if got, err := screenQuery("darn good tacos"); err != nil || got != "darn good tacos" {
+		t.Errorf("filter off: screenQuery = %q, %v, want the query unchanged", got, err)
+	}
+
+	t.Setenv("SAFETY_FILTER", "mask")
+	if got, _ := screenQuery("Darn good tacos, heckin' fast"); got != "**** good tacos, heckin' fast" {
+		t.Errorf("mask: screenQuery = %q", got)
+	}
+
+	t.Setenv("SAFETY_FILTER", "reject")
+	if _, err := screenQuery("what the heck is open"); err == nil {
+		t.Error("reject: screenQuery accepted a listed word")
+	}
+	if got, err := screenQuery("quiet dinner"); err != nil || got != "quiet dinner" {
+		t.Errorf("reject: clean query = %q, %v", got, err)
+	}
+}
+
+func TestScreenResultMasks(t *testing.T) {
+	t.Setenv("SAFETY_FILTER", "mask")
+	t.Setenv("SAFETY_WORDS", "darn")
+	res := chatResult{
+		Content:        "A darn fine spot.",
+		Recommendation: &Recommendation{Name: "Budget Bites", Reason: "darn cheap"},
+		Alternatives:   []Alternative{{Name: "Fancy Eats", Reason: "Darn fancy"}},
+		ToolCalls:      []OllamaToolCall{{}},
+	}
+	res.ToolCalls[0].Function.Arguments = json.RawMessage(`{"note":"darn"}`)
+	screenResult(&res)
+	if res.Content != "A **** fine spot." || res.Recommendation.Reason != "**** cheap" || res.Alternatives[0].Reason != "**** fancy" {
+		t.Errorf("masked result = %+v", res)
+	}
+	if got := string(res.ToolCalls[0].Function.Arguments); got != `{"note":"****"}` {
+		t.Errorf("tool arguments = %s", got)
+	}
+}
+
+func TestScreenResultRejects(t *testing.T) {
+	t.Setenv("SAFETY_FILTER", "reject")
+	t.Setenv("SAFETY_WORDS", "darn")
+	res := chatResult{Content: "Fine spot.", Alternatives: []Alternative{{Name: "Fancy Eats", Reason: "darn fancy"}}}
+	screenResult(&res)
+	if res.Content != safetyRefusal || len(res.Alternatives) != 0 {
+		t.Errorf("rejected result = %+v, want the refusal and no alternatives", res)
+	}
+
+	clean := chatResult{Content: "Fine spot."}
+	screenResult(&clean)
+	if clean.Content != "Fine spot." {
+		t.Errorf("clean reply replaced: %q", clean.Content)
+	}
+}
+
+func TestSafetyFilterInHandler(t *testing.T) {
+	t.Setenv("SAFETY_FILTER", "reject")
+	t.Setenv("SAFETY_WORDS", "darn")
+	stub := newOllamaStub(t, reply("The darn best is Fancy Eats."))
+
+	if rec := postChatCompletion(t, `{"location": "San Francisco", "query": "darn cheap food"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("rejected query status = %d, want 400", rec.Code)
+	}
+	if n := len(stub.received()); n != 0 {
+		t.Errorf("rejected query reached Ollama %d times", n)
+	}
+
+	rec := postChatCompletion(t, `{"location": "San Francisco", "query": "somewhere nice"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got := messageContent(t, decodeJSON(t, rec)); got != safetyRefusal {
+		t.Errorf("content = %q, want the refusal", got)
+	}
+
+	t.Setenv("SAFETY_FILTER", "mask")
+	rec = postChatCompletion(t, `{"location": "San Francisco"}`)
+	if got := messageContent(t, decodeJSON(t, rec)); strings.Contains(got, "darn") {
+		t.Errorf("content = %q, want the word masked", got)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// currentRequestVersion is the request schema version assumed when a request omits "version".
+const currentRequestVersion = 1
+
+// requestDecoders maps each supported request schema version to its decoder. Version 1 is
+// the location/query shape of RequestBody; later versions can change the shape while
+// existing clients keep sending version 1.
+var requestDecoders = map[int]func(data []byte) (RequestBody, error){
+	1: decodeRequestV1,
+}
+
+// decodeRequest reads a chat request body and decodes it with the decoder for its
+// "version" field. Unknown versions are a bad request. encoding/json silently keeps the
+// last of repeated keys; with STRICT_JSON=true a body repeating a key is rejected instead.
+func decodeRequest(body io.Reader) (RequestBody, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return RequestBody{}, badRequest("Invalid request body")
+	}
+	var probe struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return RequestBody{}, badRequest("Invalid request body")
+	}
+	if envBool("STRICT_JSON") {
+		if key, err := duplicateKey(data); err != nil {
+			return RequestBody{}, badRequest("Invalid request body")
+		} else if key != "" {
+			return RequestBody{}, badRequest(fmt.Sprintf("duplicate JSON key %q", key))
+		}
+	}
+	version := currentRequestVersion
+	if probe.Version != nil {
+		version = *probe.Version
+	}
+	decode, ok := requestDecoders[version]
+	if !ok {
+		return RequestBody{}, badRequest(fmt.Sprintf("unsupported request version %d", version))
+	}
+	reqData, err := decode(data)
+	if err != nil {
+		return RequestBody{}, err
+	}
+	reqData.Version = version
+	return reqData, nil
+}
+
+// decodeRequestV1 decodes the original request shape.
+func decodeRequestV1(data []byte) (RequestBody, error) {
+	var reqData RequestBody
+	if err := json.Unmarshal(data, &reqData); err != nil {
+		return RequestBody{}, badRequest("Invalid request body")
+	}
+	return reqData, nil
+}
+
+// duplicateKey scans a JSON document and returns the first object key that appears twice
+// in the same object, or "" if there is none. Keys are compared ignoring case, as
+// encoding/json matches them to struct fields: "location" and "Location" set one field.
+func duplicateKey(data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var scan func() (string, error)
+	scan = func() (string, error) {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch tok {
+		case json.Delim('{'):
+			seen := make(map[string]bool)
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return "", err
+				}
+				key := keyTok.(string)
+				if seen[strings.ToLower(key)] {
+					return key, nil
+				}
+				seen[strings.ToLower(key)] = true
+				if dup, err := scan(); dup != "" || err != nil {
+					return dup, err
+				}
+			}
+			_, err = dec.Token() // closing brace
+			return "", err
+		case json.Delim('['):
+			for dec.More() {
+				if dup, err := scan(); dup != "" || err != nil {
+					return dup, err
+				}
+			}
+			_, err = dec.Token() // closing bracket
+			return "", err
+		default:
+			return "", nil
+		}
+	}
+	return scan()
+}
+
+// fieldLimits lists the free-text request fields with a length cap: the field name
+// reported to the client, the setting overriding the cap, its default and a getter.
+var fieldLimits = []struct {
+	field   string
+	setting string
+	def     int
+	value   func(RequestBody) string
+}{
+	{"location", "MAX_LOCATION_LENGTH", 200, func(r RequestBody) string { return r.Location }},
+	{"query", "MAX_QUERY_LENGTH", 1000, func(r RequestBody) string { return r.Query }},
+}
+
+// checkFieldLengths rejects a request whose free-text fields exceed their caps, counted
+// in characters. A cap of zero or less disables the check for that field.
+func checkFieldLengths(reqData RequestBody) error {
+	for _, l := range fieldLimits {
+		limit := envInt(l.setting, l.def)
+		if limit > 0 && utf8.RuneCountInString(l.value(reqData)) > limit {
+			return badRequest(fmt.Sprintf("%s must be at most %d characters", l.field, limit))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRequestDefaultsToV1(t *testing.T) {
+	reqData, err := decodeRequest(strings.NewReader(`{"location": "San Francisco", "query": "tacos"}`))
+	if err != nil {
+		t.Fatalf("decodeRequest: %v", err)
+	}
+	if reqData.Version != 1 || reqData.Location != "San Francisco" || reqData.Query != "tacos" {
+		t.Errorf("decoded %+v, want a v1 request", reqData)
+	}
+	if reqData, err := decodeRequest(strings.NewReader(`{"version": 1, "location": "Oakland"}`)); err != nil || reqData.Location != "Oakland" {
+		t.Errorf("explicit v1: %+v, %v", reqData, err)
+	}
+}
+
+func TestDecodeRequestRejectsUnknownVersion(t *testing.T) {
+	_, err := decodeRequest(strings.NewReader(`{"version": 2, "messages": []}`))
+	if err == nil || !strings.Contains(err.Error(), "unsupported request version 2") {
+		t.Errorf("decodeRequest = %v, want an unsupported version error", err)
+	}
+	if rec := postChatCompletion(t, `{"version": 9, "location": "San Francisco"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	body := `{"location": "A", "query": "tacos", "location": "B"}`
+	reqData, err := decodeRequest(strings.NewReader(body))
+	if err != nil || reqData.Location != "B" {
+		t.Errorf("lenient: decodeRequest = %+v, %v, want the last location", reqData, err)
+	}
+
+	t.Setenv("STRICT_JSON", "true")
+	_, err = decodeRequest(strings.NewReader(body))
+	if err == nil || !strings.Contains(err.Error(), `duplicate JSON key "location"`) {
+		t.Errorf("strict: decodeRequest = %v, want a duplicate key error", err)
+	}
+	if rec := postChatCompletion(t, body); rec.Code != http.StatusBadRequest {
+		t.Errorf("strict: status %d, want 400", rec.Code)
+	}
+	_, err = decodeRequest(strings.NewReader(`{"location": "A", "Location": "B"}`))
+	if err == nil || !strings.Contains(err.Error(), `duplicate JSON key "Location"`) {
+		t.Errorf("strict: decodeRequest = %v, want keys differing only in case rejected", err)
+	}
+
+	// The same key in different objects is not a duplicate.
+	if _, err := decodeRequest(strings.NewReader(`{"location": "A", "metadata": {"location": "x", "nested": {"location": "y"}}}`)); err != nil {
+		t.Errorf("strict: nested keys rejected: %v", err)
+	}
+	if key, _ := duplicateKey([]byte(`{"tools": [{"a": 1}, {"a": 2, "b": {"c": 1, "c": 2}}]}`)); key != "c" {
+		t.Errorf("duplicateKey = %q, want c", key)
+	}
+}
+
+func TestFieldLengthLimits(t *testing.T) {
+	tests := []struct {
+		body, field string
+	}{
+		{`{"location": "` + strings.Repeat("a", 201) + `"}`, "location must be at most 200 characters"},
+		{`{"location": "San Francisco", "query": "` + strings.Repeat("q", 1001) + `"}`, "query must be at most 1000 characters"},
+	}
+	for _, tt := range tests {
+		rec := postChatCompletion(t, tt.body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.field) {
+			t.Errorf("status %d %q, want 400 naming %q", rec.Code, rec.Body, tt.field)
+		}
+	}
+
+	t.Setenv("MAX_QUERY_LENGTH", "5")
+	if err := checkFieldLengths(RequestBody{Location: "Zürich", Query: "crêpe"}); err != nil {
+		t.Errorf("five-character query rejected: %v", err)
+	}
+	if err := checkFieldLengths(RequestBody{Query: "crêpes"}); err == nil {
+		t.Error("six-character query accepted with MAX_QUERY_LENGTH=5")
+	}
+	t.Setenv("MAX_LOCATION_LENGTH", "0")
+	if err := checkFieldLengths(RequestBody{Location: strings.Repeat("a", 500)}); err != nil {
+		t.Errorf("MAX_LOCATION_LENGTH=0 still limited: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// requiredSections returns the headings listed in the comma-separated REQUIRED_SECTIONS,
+// e.g. "Top Pick,Runner-up,Budget Option".
+func requiredSections() []string {
+	var sections []string
+	for _, s := range strings.Split(os.Getenv("REQUIRED_SECTIONS"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			sections = append(sections, s)
+		}
+	}
+	return sections
+}
+
+// sectionsInstruction asks the model to organize its reply under sections.
+func sectionsInstruction(sections []string) string {
+	return fmt.Sprintf("\nOrganize the recommendation under these headings, in this order: %s.", strings.Join(sections, ", "))
+}
+
+// missingSections returns the sections whose heading doesn't appear in content. The check
+// is a light, case-insensitive substring match, so it only catches sections left out entirely.
+func missingSections(content string, sections []string) []string {
+	lower := strings.ToLower(content)
+	var missing []string
+	for _, s := range sections {
+		if !strings.Contains(lower, strings.ToLower(s)) {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
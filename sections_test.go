@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequiredSectionsInPrompt(t *testing.T) {
+	t.Setenv("REQUIRED_SECTIONS", "Top Pick, Runner-up,Budget Option")
+	stub := newOllamaStub(t, reply("Top Pick: Fancy Eats. Runner-up: The Gourmet Spot. Budget Option: Budget Bites."))
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco"}`))
+	prompt := stub.received()[0].Messages[0].Content
+	if !strings.Contains(prompt, "under these headings, in this order: Top Pick, Runner-up, Budget Option.") {
+		t.Errorf("prompt lacks the sections:\n%s", prompt)
+	}
+	if _, ok := resp["warnings"]; ok {
+		t.Errorf("warnings = %v for a complete reply", resp["warnings"])
+	}
+}
+
+func TestMissingSectionWarns(t *testing.T) {
+	t.Setenv("REQUIRED_SECTIONS", "Top Pick,Runner-up,Budget Option")
+	newOllamaStub(t, reply("top pick: Fancy Eats. Budget option: Budget Bites."))
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco"}`))
+	if want := []interface{}{`response is missing section "Runner-up"`}; !reflect.DeepEqual(resp["warnings"], want) {
+		t.Errorf("warnings = %v, want %v", resp["warnings"], want)
+	}
+}
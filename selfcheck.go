@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationSettings, intSettings and floatSettings list the numeric environment settings
+// validated at startup.
+// At runtime an invalid value only logs and falls back to the default; at startup it is fatal.
+var (
+	durationSettings = []string{"WARMUP_TIMEOUT", "CACHE_TTL", "CACHE_TTL_" + strings.ToUpper(stubProvider), "GEOCODER_TIMEOUT", "DEBOUNCE_WINDOW", "STATUS_CHECK_TIMEOUT", "SLOW_REQUEST_THRESHOLD", "SHUTDOWN_TIMEOUT", "OLLAMA_HEALTH_WINDOW", "WEATHER_TIMEOUT", "EMPTY_RESULT_RETRY_DELAY", "PROVIDER_TIMEOUT", "RESPONSE_CACHE_TTL", "HTTP_IDLE_CONN_TIMEOUT", "RETRY_BUDGET_TIME", "VALIDATE_WEBHOOK_TIMEOUT"}
+	intSettings      = []string{"GZIP_MIN_SIZE", "DIVERSITY_TOP_N", "DIVERSITY_MIN_CUISINES", "PROMPT_TOKEN_BUDGET", "PROMPT_TOKEN_HEADROOM", "ACCESS_LOG_MAX_SIZE", "ACCESS_LOG_BACKUPS", "OLLAMA_LOG_BODY_LIMIT", "PROMPT_REVIEWS_PER_RESTAURANT", "MAX_FETCH", "OLLAMA_HEALTH_MIN_CALLS", "MAX_RESPONSE_LENGTH", "WARMUP_RETRY_AFTER", "REVIEW_DEDUP_THRESHOLD", "CLOSING_SOON_MINUTES", "SUMMARY_MAX_LENGTH", "REVIEWS_PER_RESTAURANT", "METADATA_MAX_BYTES", "HTTP_MAX_IDLE_CONNS", "HTTP_MAX_IDLE_CONNS_PER_HOST", "MAX_LANGUAGES", "MAX_LOCATION_LENGTH", "MAX_QUERY_LENGTH", "RETRY_BUDGET", "IMAGE_MAX_BYTES", "CONFIDENCE_THRESHOLD", "DEBUG_RAW_LIMIT", "CUISINE_SUGGEST_DISTANCE", "DIVERSITY_MIN_PRICE_LEVELS"}
+	floatSettings    = []string{"SCORE_WEIGHT_RATING", "SCORE_WEIGHT_DISTANCE", "SCORE_WEIGHT_PRICE", "FAMILY_BOOST", "OLLAMA_FAILURE_THRESHOLD", "SURPRISE_MIN_RATING"}
+)
+
+// selfCheck validates the configuration before the server binds its port: the Ollama URLs
+// must parse, numeric settings must be well-formed, and the prompt must render for a sample
+// dataset. It returns the first problem found.
+func selfCheck() error {
+	if _, err := ollamaBackends(); err != nil {
+		return err
+	}
+
+	for _, name := range durationSettings {
+		if raw := os.Getenv(name); raw != "" {
+			if _, err := time.ParseDuration(raw); err != nil {
+				return fmt.Errorf("invalid %s %q: %w", name, raw, err)
+			}
+		}
+	}
+	for _, name := range intSettings {
+		if raw := os.Getenv(name); raw != "" {
+			if _, err := strconv.Atoi(raw); err != nil {
+				return fmt.Errorf("invalid %s %q: %w", name, raw, err)
+			}
+		}
+	}
+	for _, name := range floatSettings {
+		if raw := os.Getenv(name); raw != "" {
+			if _, err := strconv.ParseFloat(raw, 64); err != nil {
+				return fmt.Errorf("invalid %s %q: %w", name, raw, err)
+			}
+		}
+	}
+
+	if _, err := loadProfiles(); err != nil {
+		return err
+	}
+	if _, err := loadExamples(); err != nil {
+		return err
+	}
+	if _, err := loadModelDefaults(); err != nil {
+		return err
+	}
+	if name := os.Getenv("DEFAULT_TIMEZONE"); name != "" {
+		if _, err := time.LoadLocation(name); err != nil {
+			return fmt.Errorf("invalid DEFAULT_TIMEZONE %q: %w", name, err)
+		}
+	}
+
+	return checkPrompt()
+}
+
+// checkPrompt renders the prompt for a sample dataset and verifies every restaurant made it in.
+func checkPrompt() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rendering sample prompt panicked: %v", r)
+		}
+	}()
+
+	sample := []Restaurant{
+		{Name: "Sample Bistro", Address: "1 Test St", Price: 20, Rating: 4.2, Distance: 0.3, Reviews: []Review{{Text: "Nice.", Date: daysAgo(2)}}},
+		{Name: "Sample Diner", Address: "2 Test St", Price: 12, Rating: 3.9, Distance: 1.1},
+	}
+	prompt := buildPrompt(promptInput{
+		Location:    "Sample City",
+		Meal:        "dinner",
+		Query:       "something tasty",
+		Restaurants: sample,
+		Featured:    &sample[0],
+	})
+	for _, r := range sample {
+		if !strings.Contains(prompt, r.Name) {
+			return fmt.Errorf("sample prompt is missing restaurant %q", r.Name)
+		}
+	}
+	return nil
+}
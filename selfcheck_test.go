@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelfCheckPassesByDefault(t *testing.T) {
+	if err := selfCheck(); err != nil {
+		t.Fatalf("selfCheck with the default configuration: %v", err)
+	}
+}
+
+func TestSelfCheckRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name, env, value, want string
+	}{
+		{"bad Ollama URL", "OLLAMA_URL", "ollama:11434", "OLLAMA_URL"},
+		{"bad backend list", "OLLAMA_URLS", "http://a:11434,ftp://b", "OLLAMA_URL"},
+		{"bad duration", "CACHE_TTL", "ten minutes", "CACHE_TTL"},
+		{"bad integer", "MAX_FETCH", "lots", "MAX_FETCH"},
+		{"bad image limit", "IMAGE_MAX_BYTES", "4MB", "IMAGE_MAX_BYTES"},
+		{"bad score weight", "SCORE_WEIGHT_PRICE", "heavy", "SCORE_WEIGHT_PRICE"},
+		{"bad family boost", "FAMILY_BOOST", "1,5", "FAMILY_BOOST"},
+		{"bad failure threshold", "OLLAMA_FAILURE_THRESHOLD", "half", "OLLAMA_FAILURE_THRESHOLD"},
+		{"bad surprise rating", "SURPRISE_MIN_RATING", "4 stars", "SURPRISE_MIN_RATING"},
+		{"bad profiles", "MODEL_PROFILES", "{not json", "MODEL_PROFILES"},
+		{"bad time zone", "DEFAULT_TIMEZONE", "Mars/Olympus_Mons", "DEFAULT_TIMEZONE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			err := selfCheck()
+			if err == nil {
+				t.Fatalf("selfCheck accepted %s=%q", tt.env, tt.value)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not name %s", err, tt.want)
+			}
+		})
+	}
+}
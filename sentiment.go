@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	positiveWords = wordSet("amazing", "authentic", "awesome", "best", "delicious", "excellent", "fantastic",
+		"fresh", "friendly", "good", "great", "loved", "love", "nice", "perfect", "tasty", "value", "wonderful",
+		"affordable", "recommend", "ambiance", "attentive", "cozy")
+	negativeWords = wordSet("awful", "bad", "bland", "cold", "dirty", "disappointing", "expensive", "gross",
+		"horrible", "mediocre", "overpriced", "poor", "rude", "slow", "stale", "terrible", "worst", "noisy",
+		"greasy", "avoid")
+	negators = wordSet("not", "never", "no", "hardly", "isn't", "wasn't", "don't", "didn't")
+)
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// lexiconSentiment scores reviews from -1 (all negative) to 1 (all positive) by counting
+// words from small positive and negative lexicons, flipping a word preceded by a negator
+// ("not good"). It returns 0 when no sentiment words are found.
+func lexiconSentiment(reviews []string) float64 {
+	var pos, neg int
+	for _, review := range reviews {
+		words := strings.FieldsFunc(strings.ToLower(review), func(r rune) bool {
+			return !unicode.IsLetter(r) && r != '\''
+		})
+		for i, w := range words {
+			positive, negative := positiveWords[w], negativeWords[w]
+			if i > 0 && negators[words[i-1]] {
+				positive, negative = negative, positive
+			}
+			if positive {
+				pos++
+			}
+			if negative {
+				neg++
+			}
+		}
+	}
+	if pos+neg == 0 {
+		return 0
+	}
+	return float64(pos-neg) / float64(pos+neg)
+}
+
+// modelSentiment asks a (preferably small) model, SENTIMENT_MODEL or the default model,
+// to rate reviews from -1 to 1.
+func modelSentiment(ctx context.Context, reviews []string) (float64, error) {
+	model := os.Getenv("SENTIMENT_MODEL")
+	if model == "" {
+		model = defaultModel()
+	}
+	prompt := "Rate the overall sentiment of these restaurant reviews on a scale from -1 (very negative) " +
+		"to 1 (very positive). Reply with only the number.\n- " + strings.Join(reviews, "\n- ")
+	chatResp, err := sendChat(ctx, ChatRequest{
+		Model:    model,
+		Messages: []ChatMessage{{Role: "user", Content: prompt}},
+		Options:  map[string]interface{}{"temperature": 0},
+	})
+	if err != nil {
+		return 0, err
+	}
+	answer, _ := splitReasoning(chatResp.Message.Content)
+	score, err := strconv.ParseFloat(strings.TrimSpace(answer), 64)
+	if err != nil {
+		return 0, fmt.Errorf("model returned a non-numeric sentiment %q", answer)
+	}
+	if score < -1 || score > 1 {
+		return 0, fmt.Errorf("model returned an out-of-range sentiment %v", score)
+	}
+	return score, nil
+}
+
+// annotateSentiment sets Sentiment on each restaurant with reviews, using SENTIMENT_METHOD:
+// "lexicon" (fast, local), "model" (a secondary model call per restaurant, falling back to
+// the lexicon on failure) or unset to leave reviews unscored. Scored restaurants are
+// summarized in the prompt instead of listing their raw reviews. Without allowModel the
+// "model" method scores with the lexicon, for callers that must not reach the model.
+func annotateSentiment(ctx context.Context, restaurants []Restaurant, allowModel bool) {
+	method := os.Getenv("SENTIMENT_METHOD")
+	if method == "" {
+		return
+	}
+	for i := range restaurants {
+		reviews := reviewTexts(restaurants[i].Reviews)
+		if len(reviews) == 0 {
+			continue
+		}
+		score := lexiconSentiment(reviews)
+		if method == "model" && allowModel {
+			if s, err := modelSentiment(ctx, reviews); err != nil {
+				log.Printf("Model sentiment for %s failed, using lexicon: %v", restaurants[i].Name, err)
+			} else {
+				score = s
+			}
+		}
+		restaurants[i].Sentiment = &score
+	}
+}
+
+// sentimentSummary describes a sentiment score in words for the prompt.
+func sentimentSummary(score float64, reviewCount int) string {
+	var label string
+	switch {
+	case score >= 0.6:
+		label = "very positive"
+	case score >= 0.2:
+		label = "mostly positive"
+	case score > -0.2:
+		label = "mixed"
+	case score > -0.6:
+		label = "mostly negative"
+	default:
+		label = "very negative"
+	}
+	return fmt.Sprintf("%s (score %.2f across %d reviews)", label, score, reviewCount)
+}
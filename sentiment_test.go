@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLexiconSentiment(t *testing.T) {
+	tests := []struct {
+		name    string
+		reviews []string
+		check   func(float64) bool
+	}{
+		{"positive", []string{"Delicious food and friendly staff!", "Great value, would recommend."}, func(s float64) bool { return s == 1 }},
+		{"negative", []string{"Rude waiter and bland pasta.", "Overpriced and slow. Avoid."}, func(s float64) bool { return s == -1 }},
+		{"mixed", []string{"Great food, rude staff."}, func(s float64) bool { return s == 0 }},
+		{"negated", []string{"Not good, never friendly."}, func(s float64) bool { return s == -1 }},
+		{"no sentiment words", []string{"We went on a Tuesday."}, func(s float64) bool { return s == 0 }},
+		{"mostly positive", []string{"Tasty and fresh but noisy."}, func(s float64) bool { return s > 0 && s < 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if s := lexiconSentiment(tt.reviews); !tt.check(s) {
+				t.Errorf("lexiconSentiment = %v", s)
+			}
+		})
+	}
+}
+
+func TestAnnotateSentimentSummarizesReviewsInPrompt(t *testing.T) {
+	t.Setenv("SENTIMENT_METHOD", "lexicon")
+	restaurants := []Restaurant{
+		{Name: "Loved", Reviews: []Review{{Text: "Amazing and delicious."}}},
+		{Name: "Unreviewed"},
+	}
+	annotateSentiment(context.Background(), restaurants, true)
+	if restaurants[0].Sentiment == nil || *restaurants[0].Sentiment != 1 {
+		t.Fatalf("sentiment = %v, want 1", restaurants[0].Sentiment)
+	}
+	if restaurants[1].Sentiment != nil {
+		t.Error("a restaurant without reviews was scored")
+	}
+	line := restaurantLine(restaurants[0], promptInput{})
+	if !strings.Contains(line, "Review sentiment: very positive (score 1.00 across 1 reviews).") || strings.Contains(line, "Amazing") {
+		t.Errorf("prompt line = %q, want the summary instead of the reviews", line)
+	}
+}
+
+func TestModelSentimentFallsBackToLexicon(t *testing.T) {
+	newOllamaStub(t, reply("pretty good I guess"))
+	t.Setenv("SENTIMENT_METHOD", "model")
+	restaurants := []Restaurant{{Name: "Bad", Reviews: []Review{{Text: "Terrible and dirty."}}}}
+	annotateSentiment(context.Background(), restaurants, true)
+	if s := restaurants[0].Sentiment; s == nil || *s != -1 {
+		t.Errorf("sentiment = %v, want the lexicon's -1 after a non-numeric reply", s)
+	}
+
+	newOllamaStub(t, reply("0.5"))
+	annotateSentiment(context.Background(), restaurants, true)
+	if s := restaurants[0].Sentiment; s == nil || *s != 0.5 {
+		t.Errorf("sentiment = %v, want the model's 0.5", s)
+	}
+}
+
+// reviewedProvider serves the stub restaurants, each with a review to score.
+func reviewedProvider(ctx context.Context, area searchArea, opts fetchOptions) ([]Restaurant, error) {
+	restaurants, err := getRestaurants(ctx, area, opts)
+	for i := range restaurants {
+		restaurants[i].Reviews = []Review{{Text: "Friendly staff and delicious food."}}
+	}
+	return restaurants, err
+}
+
+func TestModelSentimentSkippedForDryRunsAndSingleMatches(t *testing.T) {
+	setProvider(t, reviewedProvider)
+	stub := newOllamaStub(t, reply("0.5"))
+	t.Setenv("SENTIMENT_METHOD", "model")
+
+	rec := postChatCompletion(t, `{"location":"San Francisco","query":"somewhere nice","dry_run":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry run status = %d: %s", rec.Code, rec.Body)
+	}
+	if n := len(stub.received()); n != 0 {
+		t.Errorf("dry run sent %d chat requests, want none", n)
+	}
+
+	rec = postChatCompletion(t, `{"location":"San Francisco","query":"cheap food"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "single_match") {
+		t.Fatalf("single match = %d: %s", rec.Code, rec.Body)
+	}
+	if n := len(stub.received()); n != 0 {
+		t.Errorf("single match sent %d chat requests, want none", n)
+	}
+}
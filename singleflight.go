@@ -0,0 +1,45 @@
+package main
+
+import "sync"
+
+// flightGroup collapses concurrent fetches for the same key into a single call,
+// in the spirit of golang.org/x/sync/singleflight (kept in-tree so the server
+// stays dependency-free). Results, including errors, are shared only with callers
+// that arrive while the call is in flight; nothing is remembered afterwards.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val []Restaurant
+	err error
+}
+
+// do runs fn for key, or waits for and shares the result of an identical call already in flight.
+// Each caller receives its own copy of the slice.
+func (g *flightGroup) do(key string, fn func() ([]Restaurant, error)) ([]Restaurant, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return append([]Restaurant(nil), c.val...), c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+	return append([]Restaurant(nil), c.val...), c.err
+}
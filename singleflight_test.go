@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupSharesConcurrentFetches(t *testing.T) {
+	var g flightGroup
+	var fetches atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	fetch := func() ([]Restaurant, error) {
+		if fetches.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []Restaurant{{Name: "Budget Bites"}}, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([][]Restaurant, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do("stub|san francisco", fetch)
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // let the other callers join the flight
+	close(release)
+	wg.Wait()
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("%d underlying fetches, want 1", got)
+	}
+	for i, rs := range results {
+		if len(rs) != 1 || rs[0].Name != "Budget Bites" {
+			t.Errorf("caller %d got %v", i, rs)
+		}
+	}
+	results[0][0].Name = "changed"
+	if results[1][0].Name != "Budget Bites" {
+		t.Error("callers share one slice")
+	}
+}
+
+func TestFlightGroupForgetsErrors(t *testing.T) {
+	var g flightGroup
+	calls := 0
+	fail := func() ([]Restaurant, error) {
+		calls++
+		return nil, errors.New("provider down")
+	}
+	if _, err := g.do("k", fail); err == nil {
+		t.Fatal("do returned no error")
+	}
+	if _, err := g.do("k", fail); err == nil {
+		t.Fatal("do returned no error")
+	}
+	if calls != 2 {
+		t.Errorf("fetch ran %d times, want the error forgotten after the first call", calls)
+	}
+}
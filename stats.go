@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// serverStats holds lightweight counters for capacity planning. They reset on restart.
+var serverStats struct {
+	totalRequests  atomic.Int64
+	inFlight       atomic.Int64
+	ollamaCalls    atomic.Int64
+	ollamaNanosSum atomic.Int64
+}
+
+// statsMiddleware counts total and in-flight requests.
+func statsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverStats.totalRequests.Add(1)
+		serverStats.inFlight.Add(1)
+		defer serverStats.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordOllamaLatency adds one Ollama call of duration d to the running average.
+func recordOllamaLatency(d time.Duration) {
+	serverStats.ollamaCalls.Add(1)
+	serverStats.ollamaNanosSum.Add(int64(d))
+}
+
+// handleStats serves /stats: request totals and average Ollama latency since start,
+// a lighter alternative to a full metrics stack.
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	var avgMS float64
+	if calls := serverStats.ollamaCalls.Load(); calls > 0 {
+		avgMS = float64(serverStats.ollamaNanosSum.Load()) / float64(calls) / float64(time.Millisecond)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total_requests":        serverStats.totalRequests.Load(),
+		"in_flight_requests":    serverStats.inFlight.Load(),
+		"ollama_calls":          serverStats.ollamaCalls.Load(),
+		"avg_ollama_latency_ms": avgMS,
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// resetStats zeroes the server counters so a test sees only its own requests.
+func resetStats() {
+	serverStats.totalRequests.Store(0)
+	serverStats.inFlight.Store(0)
+	serverStats.ollamaCalls.Store(0)
+	serverStats.ollamaNanosSum.Store(0)
+}
+
+func TestStatsCountsRequests(t *testing.T) {
+	resetStats()
+	var inFlight int64
+	handler := statsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = serverStats.inFlight.Load()
+	}))
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/restaurants", nil))
+	}
+	if inFlight != 1 {
+		t.Errorf("in-flight during a request = %d, want 1", inFlight)
+	}
+	recordOllamaLatency(10 * time.Millisecond)
+	recordOllamaLatency(30 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	handleStats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	resp := decodeJSON(t, rec)
+	want := map[string]float64{"total_requests": 3, "in_flight_requests": 0, "ollama_calls": 2, "avg_ollama_latency_ms": 20}
+	for key, v := range want {
+		if resp[key] != v {
+			t.Errorf("%s = %v, want %v", key, resp[key], v)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// startTime records when the process started, for reporting uptime.
+var startTime = time.Now()
+
+// dependencyStatus is the result of checking one dependency.
+type dependencyStatus struct {
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// checkOllama queries Ollama's /api/version endpoint.
+func checkOllama(ctx context.Context) dependencyStatus {
+	endpoint, err := ollamaEndpoint("/api/version")
+	if err != nil {
+		return dependencyStatus{Error: err.Error()}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return dependencyStatus{Error: err.Error()}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return dependencyStatus{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return dependencyStatus{Error: fmt.Sprintf("status %d", resp.StatusCode)}
+	}
+	var body struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return dependencyStatus{Error: fmt.Sprintf("failed to decode version: %v", err)}
+	}
+	return dependencyStatus{Reachable: true, Version: body.Version}
+}
+
+// checkProvider reports whether the restaurant data provider is reachable. The built-in
+// stub serves from memory, so it always is; real providers should probe their API here.
+func checkProvider(ctx context.Context) dependencyStatus {
+	return dependencyStatus{Reachable: true, Version: stubProvider}
+}
+
+// statusChecks lists the dependency checks reported by /status, by name.
+var statusChecks = map[string]func(context.Context) dependencyStatus{
+	"ollama":   checkOllama,
+	"provider": checkProvider,
+}
+
+// handleStatus serves /status: a diagnostic summary of every dependency plus cache size,
+// uptime and build version. Checks run concurrently, each bounded by STATUS_CHECK_TIMEOUT.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	timeout := envDuration("STATUS_CHECK_TIMEOUT", 2*time.Second)
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		deps = make(map[string]dependencyStatus, len(statusChecks))
+	)
+	for name, check := range statusChecks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) dependencyStatus) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			start := time.Now()
+			result := check(ctx)
+			result.LatencyMS = time.Since(start).Milliseconds()
+			mu.Lock()
+			deps[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	overall := "ok"
+	for _, d := range deps {
+		if !d.Reachable {
+			overall = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         overall,
+		"version":        version,
+		"commit":         commit,
+		"build_time":     buildTime,
+		"uptime_seconds": int64(time.Since(startTime).Seconds()),
+		"cache":          map[string]int{"entries": cache.size()},
+		"dependencies":   deps,
+	})
+}
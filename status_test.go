@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getStatus(t *testing.T) map[string]interface{} {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	return decodeJSON(t, rec)
+}
+
+func TestStatusAggregatesDependencies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version": "0.5.7"}`))
+	}))
+	defer srv.Close()
+	t.Setenv("OLLAMA_URL", srv.URL)
+
+	resp := getStatus(t)
+	if resp["status"] != "ok" {
+		t.Errorf("status = %v, want ok", resp["status"])
+	}
+	for _, key := range []string{"version", "commit", "build_time", "uptime_seconds", "cache"} {
+		if _, ok := resp[key]; !ok {
+			t.Errorf("status lacks %q", key)
+		}
+	}
+	deps, _ := resp["dependencies"].(map[string]interface{})
+	ollama, _ := deps["ollama"].(map[string]interface{})
+	if ollama["reachable"] != true || ollama["version"] != "0.5.7" {
+		t.Errorf("ollama = %v, want reachable with its version", ollama)
+	}
+	if provider, _ := deps["provider"].(map[string]interface{}); provider["reachable"] != true {
+		t.Errorf("provider = %v, want reachable", provider)
+	}
+}
+
+func TestStatusReportsUnreachableOllama(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	t.Setenv("OLLAMA_URL", srv.URL)
+
+	resp := getStatus(t)
+	if resp["status"] != "degraded" {
+		t.Errorf("status = %v, want degraded", resp["status"])
+	}
+	ollama := resp["dependencies"].(map[string]interface{})["ollama"].(map[string]interface{})
+	if ollama["reachable"] != false || ollama["error"] != "status 502" {
+		t.Errorf("ollama = %v, want unreachable with the status", ollama)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Recommendation is the typed pick returned when a request sets "structured".
+type Recommendation struct {
+	Name       string `json:"name"`
+	Reason     string `json:"reason"`
+	Confidence int    `json:"confidence"` // 1 (a guess) to 5 (certain); 0 when parsed from prose
+}
+
+// recommendationSchema is the JSON schema passed as Ollama's "format", constraining the
+// reply to a Recommendation.
+var recommendationSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"reason": {"type": "string"},
+		"confidence": {"type": "integer", "minimum": 1, "maximum": 5}
+	},
+	"required": ["name", "reason", "confidence"]
+}`)
+
+// structuredInstruction is appended to the prompt so models without schema support still
+// know what shape to answer in.
+const structuredInstruction = "\nRespond only with a JSON object with the fields \"name\" (the restaurant you recommend), " +
+	"\"reason\" (one or two sentences) and \"confidence\" (an integer from 1 to 5)."
+
+var firstSentence = regexp.MustCompile(`^[^.!?]*[.!?]`)
+
+// parseRecommendation reads a Recommendation from the model's content. If the content is not
+// a valid recommendation for one of restaurants (matched by name, ignoring case), it falls
+// back to the restaurant the prose mentions first, with the first sentence as the reason and
+// zero confidence; for a JSON answer naming an unknown place, the prose is its reason. The
+// bool is false only when no recommendation could be found at all.
+func parseRecommendation(content string, restaurants []Restaurant) (Recommendation, bool) {
+	var rec Recommendation
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &rec); err == nil && rec.Name != "" && rec.Reason != "" {
+		for _, r := range restaurants {
+			if strings.EqualFold(strings.TrimSpace(rec.Name), r.Name) {
+				rec.Name = r.Name
+				if rec.Confidence < 1 {
+					rec.Confidence = 1
+				} else if rec.Confidence > 5 {
+					rec.Confidence = 5
+				}
+				return rec, true
+			}
+		}
+		content = rec.Reason
+	}
+
+	i := mentionedFirst(restaurants, content)
+	if i < 0 {
+		return Recommendation{}, false
+	}
+	reason := strings.TrimSpace(content)
+	if m := firstSentence.FindString(reason); m != "" {
+		reason = m
+	}
+	return Recommendation{Name: restaurants[i].Name, Reason: reason}, true
+}
+
+// refineNote is appended to a low-confidence recommendation, except in summary mode.
+const refineNote = "I'm not very sure about this one; you might want to refine your query, for example with a cuisine, price range or neighborhood."
+
+// lowConfidence reports whether rec's confidence is below CONFIDENCE_THRESHOLD (1 to 5;
+// default 0, which disables the check). A recommendation parsed from prose has no
+// confidence and is never considered low.
+func lowConfidence(rec Recommendation) bool {
+	return rec.Confidence > 0 && rec.Confidence < envInt("CONFIDENCE_THRESHOLD", 0)
+}
+
+// recommendationText renders rec as prose for the message content.
+func recommendationText(rec Recommendation) string {
+	if strings.Contains(rec.Reason, rec.Name) {
+		return rec.Reason
+	}
+	return fmt.Sprintf("%s: %s", rec.Name, rec.Reason)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseRecommendation(t *testing.T) {
+	restaurants := []Restaurant{{Name: "Budget Bites"}, {Name: "Fancy Eats"}}
+	tests := []struct {
+		content string
+		want    Recommendation
+		ok      bool
+	}{
+		{`{"name": "Fancy Eats", "reason": "Great for a date.", "confidence": 4}`, Recommendation{"Fancy Eats", "Great for a date.", 4}, true},
+		{`{"name": "Fancy Eats", "reason": "Certain.", "confidence": 9}`, Recommendation{"Fancy Eats", "Certain.", 5}, true},
+		{"You'll love Budget Bites. Fancy Eats is pricier.", Recommendation{"Budget Bites", "You'll love Budget Bites.", 0}, true},
+		{`{"name": "Fancy Eats"}`, Recommendation{"Fancy Eats", `{"name": "Fancy Eats"}`, 0}, true},
+		{`{"name": "fancy eats ", "reason": "Great for a date.", "confidence": 4}`, Recommendation{"Fancy Eats", "Great for a date.", 4}, true},
+		{`{"name": "Chez Nowhere", "reason": "Better than Budget Bites. Trust me.", "confidence": 5}`, Recommendation{"Budget Bites", "Better than Budget Bites.", 0}, true},
+		{`{"name": "Chez Nowhere", "reason": "A hidden gem.", "confidence": 5}`, Recommendation{}, false},
+		{"Nothing here fits.", Recommendation{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRecommendation(tt.content, restaurants)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRecommendation(%q) = %+v, %v, want %+v, %v", tt.content, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestStructuredResponse(t *testing.T) {
+	stub := newOllamaStub(t, reply(`{"name": "Fancy Eats", "reason": "Fancy Eats suits a special night.", "confidence": 5}`))
+	rec := postChatCompletion(t, `{"location": "San Francisco", "structured": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if sent := stub.received()[0]; len(sent.Format) == 0 || !strings.Contains(sent.Messages[len(sent.Messages)-1].Content, "Respond only with a JSON object") {
+		t.Error("structured request sent no schema or instruction")
+	}
+	resp := decodeJSON(t, rec)
+	pick, _ := resp["recommendation"].(map[string]interface{})
+	if pick["name"] != "Fancy Eats" || pick["confidence"] != 5.0 {
+		t.Errorf("recommendation = %v", resp["recommendation"])
+	}
+	if got := messageContent(t, resp); got != "Fancy Eats suits a special night." {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestStructuredFallsBackToProse(t *testing.T) {
+	newOllamaStub(t, reply("Budget Bites is the best value around. It's quick too."))
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco", "structured": true}`))
+	pick, _ := resp["recommendation"].(map[string]interface{})
+	if pick["name"] != "Budget Bites" || pick["reason"] != "Budget Bites is the best value around." || pick["confidence"] != 0.0 {
+		t.Errorf("recommendation = %v, want one parsed from the prose", resp["recommendation"])
+	}
+}
+
+func TestLowConfidence(t *testing.T) {
+	t.Setenv("CONFIDENCE_THRESHOLD", "3")
+	tests := []struct {
+		confidence int
+		low        bool
+	}{{1, true}, {2, true}, {3, false}, {5, false}, {0, false}}
+	for _, tt := range tests {
+		if got := lowConfidence(Recommendation{Confidence: tt.confidence}); got != tt.low {
+			t.Errorf("lowConfidence(%d) = %v, want %v", tt.confidence, got, tt.low)
+		}
+	}
+	t.Setenv("CONFIDENCE_THRESHOLD", "")
+	if lowConfidence(Recommendation{Confidence: 1}) {
+		t.Error("low confidence reported with the check disabled")
+	}
+}
+
+func TestLowConfidenceResponse(t *testing.T) {
+	t.Setenv("CONFIDENCE_THRESHOLD", "3")
+	for _, tt := range []struct {
+		confidence string
+		low        bool
+	}{{"2", true}, {"4", false}} {
+		newOllamaStub(t, reply(`{"name": "Fancy Eats", "reason": "It might suit you.", "confidence": `+tt.confidence+`}`))
+		resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco", "structured": true}`))
+		content := messageContent(t, resp)
+		if got := resp["low_confidence"] == true; got != tt.low {
+			t.Errorf("confidence %s: low_confidence = %v, want %v", tt.confidence, resp["low_confidence"], tt.low)
+		}
+		if got := strings.HasSuffix(content, refineNote); got != tt.low {
+			t.Errorf("confidence %s: content %q, refine note present %v, want %v", tt.confidence, content, got, tt.low)
+		}
+	}
+}
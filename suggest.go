@@ -0,0 +1,48 @@
+package main
+
+import "strings"
+
+// suggestCuisine returns the cuisine among restaurants closest to the misspelled want, if
+// it is within CUISINE_SUGGEST_DISTANCE edits (default 2). It returns "" when nothing is
+// close enough or want already names one of them.
+func suggestCuisine(want string, restaurants []Restaurant) string {
+	want = strings.ToLower(strings.TrimSpace(want))
+	best, bestDist := "", envInt("CUISINE_SUGGEST_DISTANCE", 2)+1
+	seen := make(map[string]bool)
+	for _, r := range restaurants {
+		cuisine := strings.ToLower(r.Cuisine)
+		if cuisine == "" || seen[cuisine] {
+			continue
+		}
+		seen[cuisine] = true
+		if cuisine == want {
+			return ""
+		}
+		if d := levenshtein(want, cuisine); d < bestDist || (d == bestDist && best != "" && cuisine < best) {
+			best, bestDist = cuisine, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b, counting runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
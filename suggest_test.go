@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestSuggestCuisine(t *testing.T) {
+	restaurants := []Restaurant{{Cuisine: "Italian"}, {Cuisine: "thai"}, {Cuisine: "french"}, {Cuisine: "italian"}}
+	tests := map[string]string{
+		"itallian": "italian",
+		"Tai":      "thai",
+		"frnch":    "french",
+		"italian":  "",
+		"burgers":  "",
+	}
+	for want, expected := range tests {
+		if got := suggestCuisine(want, restaurants); got != expected {
+			t.Errorf("suggestCuisine(%q) = %q, want %q", want, got, expected)
+		}
+	}
+
+	t.Setenv("CUISINE_SUGGEST_DISTANCE", "1")
+	if got := suggestCuisine("frnh", restaurants); got != "" {
+		t.Errorf("suggestion %q beyond CUISINE_SUGGEST_DISTANCE", got)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{{"", "", 0}, {"thai", "", 4}, {"kitten", "sitting", 3}, {"crêpe", "crepe", 1}}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestionInResponse(t *testing.T) {
+	rec := getRestaurantList(t, "location=San+Francisco&cuisine=frnch")
+	suggestion, _ := decodeJSON(t, rec)["suggestion"].(map[string]interface{})
+	if suggestion["cuisine"] != "french" {
+		t.Errorf("suggestion = %v, want french", suggestion)
+	}
+	rec = getRestaurantList(t, "location=San+Francisco&cuisine=burgers")
+	if s, ok := decodeJSON(t, rec)["suggestion"]; ok {
+		t.Errorf("suggestion %v for an unrelated cuisine", s)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// zoneCache remembers the time zone resolved for each search area.
+type zoneCache struct {
+	mu    sync.Mutex
+	zones map[string]*time.Location // by searchArea.key()
+}
+
+var zones = &zoneCache{zones: make(map[string]*time.Location)}
+
+// defaultLocation returns the DEFAULT_TIMEZONE zone (an IANA name such as
+// "America/New_York"), or the server's local zone when it is unset or invalid.
+func defaultLocation() *time.Location {
+	name := os.Getenv("DEFAULT_TIMEZONE")
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Invalid DEFAULT_TIMEZONE %q, using server local time", name)
+		return time.Local
+	}
+	return loc
+}
+
+// areaLocation returns the time zone of area, taken from the first provider-supplied
+// Restaurant.Timezone and cached per area. Without one it falls back to defaultLocation.
+func areaLocation(area searchArea, restaurants []Restaurant) *time.Location {
+	key := area.key()
+	zones.mu.Lock()
+	loc, ok := zones.zones[key]
+	zones.mu.Unlock()
+	if ok {
+		return loc
+	}
+
+	for _, r := range restaurants {
+		if r.Timezone == "" {
+			continue
+		}
+		loc, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			log.Printf("Ignoring unknown time zone %q for %s", r.Timezone, r.Name)
+			continue
+		}
+		zones.mu.Lock()
+		zones.zones[key] = loc
+		zones.mu.Unlock()
+		return loc
+	}
+	return defaultLocation()
+}
+
+// flush forgets the zone for area, or all zones when area is empty, and returns how
+// many were removed.
+func (z *zoneCache) flush(area string) int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if area == "" {
+		n := len(z.zones)
+		z.zones = make(map[string]*time.Location)
+		return n
+	}
+	if _, ok := z.zones[area]; !ok {
+		return 0
+	}
+	delete(z.zones, area)
+	return 1
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOpenNowUsesAreaTimezone(t *testing.T) {
+	zones.flush("")
+	t.Cleanup(func() { zones.flush("") })
+	t.Setenv("CLOSING_SOON_MINUTES", "180")
+	// 20:00 in San Francisco, 23:00 in New York.
+	setClock(t, time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC))
+	place := func(tz string) []Restaurant {
+		return []Restaurant{{Name: "Diner", Timezone: tz, Hours: everyDay("11:00", "22:00")}}
+	}
+
+	west := place("America/Los_Angeles")
+	loc := areaLocation(searchArea{Name: "San Francisco"}, west)
+	annotateClosingSoon(west, loc)
+	if west[0].ClosesInMinutes == nil || *west[0].ClosesInMinutes != 120 {
+		t.Errorf("San Francisco closes in %v, want 120 minutes", west[0].ClosesInMinutes)
+	}
+	if closedAt(west[0], now().In(loc)) {
+		t.Error("San Francisco diner reported closed at 20:00")
+	}
+
+	east := place("America/New_York")
+	loc = areaLocation(searchArea{Name: "New York"}, east)
+	annotateClosingSoon(east, loc)
+	if east[0].ClosesInMinutes != nil {
+		t.Errorf("New York closes in %d minutes, want it closed", *east[0].ClosesInMinutes)
+	}
+	if !closedAt(east[0], now().In(loc)) {
+		t.Error("New York diner reported open at 23:00")
+	}
+}
+
+func TestAreaLocationIsCachedAndFallsBack(t *testing.T) {
+	zones.flush("")
+	t.Cleanup(func() { zones.flush("") })
+	area := searchArea{Name: "Chicago"}
+	if loc := areaLocation(area, []Restaurant{{Timezone: "America/Chicago"}}); loc.String() != "America/Chicago" {
+		t.Fatalf("areaLocation = %s", loc)
+	}
+	if loc := areaLocation(area, nil); loc.String() != "America/Chicago" {
+		t.Errorf("cached areaLocation = %s, want America/Chicago", loc)
+	}
+
+	t.Setenv("DEFAULT_TIMEZONE", "Europe/Zurich")
+	if loc := areaLocation(searchArea{Name: "Nowhere"}, []Restaurant{{Timezone: "Mars/Olympus"}}); loc.String() != "Europe/Zurich" {
+		t.Errorf("fallback areaLocation = %s, want DEFAULT_TIMEZONE", loc)
+	}
+	t.Setenv("DEFAULT_TIMEZONE", "Not/AZone")
+	if loc := defaultLocation(); loc != time.Local {
+		t.Errorf("invalid DEFAULT_TIMEZONE gave %s, want local time", loc)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import "unicode/utf8"
+
+// estimateTokens approximates how many tokens text occupies, using the common
+// rule of thumb of about four characters per token for English text. Ollama has
+// no tokenize endpoint, so this heuristic is the only estimate available.
+func estimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	return (n + 3) / 4
+}
+
+// estimateChatTokens approximates the prompt size of a whole chat request,
+// allowing a few tokens per message for the chat template's role markers.
+func estimateChatTokens(chatReq ChatRequest) int {
+	const perMessageOverhead = 4
+	total := 0
+	for _, m := range chatReq.Messages {
+		total += estimateTokens(m.Content) + perMessageOverhead
+	}
+	return total
+}
+
+// fitTokenBudget returns the longest prefix of in.Restaurants, in rank order, whose prompt
+// entries fit within budget tokens after reserving headroom tokens for the surrounding
+// instruction text. Entries are sized individually, so a restaurant with long reviews
+// costs more of the budget than a terse one.
+func fitTokenBudget(in promptInput, budget, headroom int) []Restaurant {
+	remaining := budget - headroom
+	for i, r := range in.Restaurants {
+		remaining -= estimateTokens(restaurantLine(r, in))
+		if remaining < 0 {
+			return in.Restaurants[:i]
+		}
+	}
+	return in.Restaurants
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	for text, want := range map[string]int{"": 0, "abc": 1, "abcd": 1, "abcde": 2, "héllo wörld!": 3} {
+		if got := estimateTokens(text); got != want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+	chatReq := ChatRequest{Messages: []ChatMessage{{Content: "abcd"}, {Content: "abcdefgh"}}}
+	if got := estimateChatTokens(chatReq); got != 1+2+2*4 {
+		t.Errorf("estimateChatTokens = %d, want 11", got)
+	}
+}
+
+func TestDryRunSkipsGeneration(t *testing.T) {
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+
+	rec := postChatCompletion(t, `{"location": "San Francisco", "dry_run": true}`)
+	resp := decodeJSON(t, rec)
+	if n := len(stub.received()); n != 0 {
+		t.Errorf("dry run made %d Ollama calls, want none", n)
+	}
+	if resp["object"] != "chat.completion.dry_run" {
+		t.Errorf("object = %v", resp["object"])
+	}
+	if tokens, _ := resp["estimated_prompt_tokens"].(float64); tokens <= 0 {
+		t.Errorf("estimated_prompt_tokens = %v, want a positive estimate", resp["estimated_prompt_tokens"])
+	}
+	if _, ok := resp["messages"]; ok {
+		t.Error("dry run revealed the messages without DEBUG_ENDPOINTS")
+	}
+}
+
+func TestDryRunShowsMessagesWithDebug(t *testing.T) {
+	newOllamaStub(t, reply("unused"))
+	t.Setenv("DEBUG_ENDPOINTS", "true")
+
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco", "dry_run": true}`))
+	messages, _ := resp["messages"].([]interface{})
+	if len(messages) == 0 {
+		t.Fatalf("messages = %v, want the rendered prompt", resp["messages"])
+	}
+}
+
+func TestFitTokenBudget(t *testing.T) {
+	short := Restaurant{Name: "Terse", Reviews: []Review{{Text: "Good."}}}
+	long := Restaurant{Name: "Wordy", Reviews: []Review{{Text: strings.Repeat("An extremely detailed review. ", 40)}}}
+	other := Restaurant{Name: "Plain", Reviews: []Review{{Text: "Fine."}}}
+	in := promptInput{Restaurants: []Restaurant{short, long, other}}
+	shortCost := estimateTokens(restaurantLine(short, in))
+	longCost := estimateTokens(restaurantLine(long, in))
+	if longCost < 5*shortCost {
+		t.Fatalf("sample entries are too similar: %d vs %d tokens", shortCost, longCost)
+	}
+
+	tests := []struct {
+		name             string
+		budget, headroom int
+		want             []string
+	}{
+		{"everything fits", 10000, 200, []string{"Terse", "Wordy", "Plain"}},
+		{"long entry exceeds the rest", 100 + shortCost + longCost - 1, 100, []string{"Terse"}},
+		{"exact fit", 100 + shortCost + longCost, 100, []string{"Terse", "Wordy"}},
+		{"headroom eats the budget", 100, 100, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept := fitTokenBudget(in, tt.budget, tt.headroom)
+			if got := names(kept); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+			used := 0
+			for _, r := range kept {
+				used += estimateTokens(restaurantLine(r, in))
+			}
+			if used > tt.budget-tt.headroom {
+				t.Errorf("kept entries use %d tokens, over the %d available", used, tt.budget-tt.headroom)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tonePreset is the generation setup a named tone maps to.
+type tonePreset struct {
+	Temperature  float64
+	SystemPrompt string
+}
+
+// tonePresets maps the operator-friendly "tone" request field to model settings:
+//
+//	precise   temperature 0.2, sticks closely to the listed facts
+//	balanced  temperature 0.7, friendly and informative
+//	creative  temperature 1.0, vivid and playful descriptions
+//
+// An explicit "temperature" in the request overrides the preset's temperature.
+var tonePresets = map[string]tonePreset{
+	"precise": {
+		Temperature:  0.2,
+		SystemPrompt: "You are a precise restaurant guide. Stick closely to the facts provided and keep recommendations short and concrete.",
+	},
+	"balanced": {
+		Temperature:  0.7,
+		SystemPrompt: "You are a friendly restaurant guide. Give helpful, well-rounded recommendations based on the facts provided.",
+	},
+	"creative": {
+		Temperature:  1.0,
+		SystemPrompt: "You are an enthusiastic restaurant guide. Describe the options vividly and playfully, without inventing facts that weren't provided.",
+	},
+}
+
+// resolveTone looks up the preset for tone. An empty tone returns nil.
+func resolveTone(tone string) (*tonePreset, error) {
+	if tone == "" {
+		return nil, nil
+	}
+	preset, ok := tonePresets[strings.ToLower(tone)]
+	if !ok {
+		return nil, fmt.Errorf("unknown tone %q (want precise, balanced or creative)", tone)
+	}
+	return &preset, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestToneSetsTemperature(t *testing.T) {
+	for tone, want := range map[string]float64{"precise": 0.2, "balanced": 0.7, "creative": 1.0} {
+		chatReq, err := buildChatRequest(RequestBody{Tone: tone}, "prompt")
+		if err != nil {
+			t.Fatalf("tone %s: %v", tone, err)
+		}
+		if got := chatReq.Options["temperature"]; got != want {
+			t.Errorf("tone %s: temperature = %v, want %v", tone, got, want)
+		}
+		if first := chatReq.Messages[0]; first.Role != "system" || first.Content != tonePresets[tone].SystemPrompt {
+			t.Errorf("tone %s: first message = %+v, want the tone's system prompt", tone, first)
+		}
+	}
+}
+
+func TestExplicitTemperatureBeatsTone(t *testing.T) {
+	temperature := 1.5
+	chatReq, err := buildChatRequest(RequestBody{Tone: "precise", Temperature: &temperature}, "prompt")
+	if err != nil {
+		t.Fatalf("buildChatRequest: %v", err)
+	}
+	if got := chatReq.Options["temperature"]; got != 1.5 {
+		t.Errorf("temperature = %v, want the explicit 1.5", got)
+	}
+}
+
+func TestUnknownToneIsRejected(t *testing.T) {
+	if _, err := buildChatRequest(RequestBody{Tone: "sarcastic"}, "prompt"); err == nil {
+		t.Error("buildChatRequest accepted an unknown tone")
+	}
+	chatReq, err := buildChatRequest(RequestBody{}, "prompt")
+	if err != nil {
+		t.Fatalf("buildChatRequest: %v", err)
+	}
+	if _, ok := chatReq.Options["temperature"]; ok || len(chatReq.Messages) != 1 {
+		t.Errorf("no tone still set a temperature or system prompt: %+v", chatReq)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// OllamaToolCall is a tool invocation emitted by a tool-capable model.
+type OllamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // a JSON object
+	} `json:"function"`
+}
+
+// toolsEnabled reports whether the request's tools should be forwarded to the model.
+// Ollama has no tool_choice parameter, so only "none" (which disables tools) is honored;
+// any other choice leaves the decision to the model.
+func toolsEnabled(reqData RequestBody) bool {
+	if len(reqData.Tools) == 0 {
+		return false
+	}
+	var choice string
+	if err := json.Unmarshal(reqData.ToolChoice, &choice); err == nil && choice == "none" {
+		return false
+	}
+	return true
+}
+
+// toOpenAIToolCalls maps Ollama tool calls into the OpenAI response shape, where
+// arguments are a JSON-encoded string and each call carries an id.
+func toOpenAIToolCalls(calls []OllamaToolCall) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(calls))
+	for i, call := range calls {
+		args := string(call.Function.Arguments)
+		if args == "" {
+			args = "{}"
+		}
+		out = append(out, map[string]interface{}{
+			"id":   fmt.Sprintf("call_%d", i),
+			"type": "function",
+			"function": map[string]string{
+				"name":      call.Function.Name,
+				"arguments": args,
+			},
+		})
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const weatherTool = `{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}`
+
+func TestToolCallsMapToOpenAIShape(t *testing.T) {
+	stub := newOllamaStub(t, func(w http.ResponseWriter, req ChatRequest) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model": "m", "message": {"role": "assistant", "content": "", "tool_calls": [
+			{"function": {"name": "get_weather", "arguments": {"city": "San Francisco"}}}]}, "done": true}`))
+	})
+
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco", "tools": [`+weatherTool+`]}`))
+
+	got := stub.received()
+	if len(got) != 1 || len(got[0].Tools) != 1 {
+		t.Fatalf("tools were not forwarded to Ollama: %+v", got)
+	}
+	choice := resp["choices"].([]interface{})[0].(map[string]interface{})
+	if choice["finish_reason"] != "tool_calls" {
+		t.Errorf("finish_reason = %v, want tool_calls", choice["finish_reason"])
+	}
+	calls, _ := choice["message"].(map[string]interface{})["tool_calls"].([]interface{})
+	if len(calls) != 1 {
+		t.Fatalf("tool_calls = %v, want one call", calls)
+	}
+	call := calls[0].(map[string]interface{})
+	fn := call["function"].(map[string]interface{})
+	if call["type"] != "function" || call["id"] != "call_0" || fn["name"] != "get_weather" {
+		t.Errorf("tool call = %v", call)
+	}
+	var args map[string]string
+	if err := json.Unmarshal([]byte(fn["arguments"].(string)), &args); err != nil || args["city"] != "San Francisco" {
+		t.Errorf("arguments = %v, want a JSON string with the city", fn["arguments"])
+	}
+}
+
+func TestPlainContentWithTools(t *testing.T) {
+	newOllamaStub(t, reply("Try Fancy Eats."))
+
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco", "tools": [`+weatherTool+`]}`))
+	choice := resp["choices"].([]interface{})[0].(map[string]interface{})
+	if choice["finish_reason"] != "stop" {
+		t.Errorf("finish_reason = %v, want stop", choice["finish_reason"])
+	}
+	if _, ok := choice["message"].(map[string]interface{})["tool_calls"]; ok {
+		t.Error("plain content reply has tool_calls")
+	}
+}
+
+func TestToolChoiceNoneDisablesTools(t *testing.T) {
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+
+	postChatCompletion(t, `{"location": "San Francisco", "tools": [`+weatherTool+`], "tool_choice": "none"}`)
+	if got := stub.received(); len(got) != 1 || len(got[0].Tools) != 0 {
+		t.Errorf("tools forwarded despite tool_choice none: %+v", got)
+	}
+}
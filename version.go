@@ -0,0 +1,20 @@
+package main
+
+import "net/http"
+
+// Build metadata, set at build time with e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// versionMiddleware adds an X-Server-Version header to every response.
+func versionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Server-Version", version)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionHeader(t *testing.T) {
+	old := version
+	version = "1.2.3"
+	t.Cleanup(func() { version = old })
+
+	handler := versionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusNotFound)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/anything", nil))
+	if got := rec.Header().Get("X-Server-Version"); got != "1.2.3" {
+		t.Errorf("X-Server-Version = %q, want 1.2.3 even on errors", got)
+	}
+}
+
+func TestStatusReportsBuildMetadata(t *testing.T) {
+	resp := getStatus(t)
+	if resp["version"] != version || resp["commit"] != commit || resp["build_time"] != buildTime {
+		t.Errorf("status build metadata = %v/%v/%v, want %s/%s/%s", resp["version"], resp["commit"], resp["build_time"], version, commit, buildTime)
+	}
+}
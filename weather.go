@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// weatherProvider returns a short description of the current weather in area,
+// such as "Sunny, +18°C".
+type weatherProvider func(ctx context.Context, area searchArea) (string, error)
+
+// weatherProviders maps WEATHER_PROVIDER values to their implementations.
+var weatherProviders = map[string]weatherProvider{
+	"wttr": wttrWeather,
+}
+
+// currentWeather looks up the weather for area with the provider selected by
+// WEATHER_PROVIDER (default "wttr"), bounded by WEATHER_TIMEOUT (default 2s).
+func currentWeather(ctx context.Context, area searchArea) (string, error) {
+	name := os.Getenv("WEATHER_PROVIDER")
+	if name == "" {
+		name = "wttr"
+	}
+	provider, ok := weatherProviders[name]
+	if !ok {
+		return "", fmt.Errorf("unknown WEATHER_PROVIDER %q", name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, envDuration("WEATHER_TIMEOUT", 2*time.Second))
+	defer cancel()
+	return provider(ctx, area)
+}
+
+// wttrWeather queries a wttr.in-compatible service (WEATHER_URL, defaulting to the
+// public instance) for a one-line condition and temperature.
+func wttrWeather(ctx context.Context, area searchArea) (string, error) {
+	base := os.Getenv("WEATHER_URL")
+	if base == "" {
+		base = "https://wttr.in"
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid WEATHER_URL %q: %w", base, err)
+	}
+	place := area.Name
+	if area.Center != nil {
+		place = fmt.Sprintf("%.4f,%.4f", area.Center.Lat, area.Center.Lon)
+	}
+	u = u.JoinPath(place)
+	u.RawQuery = url.Values{"format": {"%C, %t"}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("weather service returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	weather := strings.TrimSpace(string(body))
+	if weather == "" {
+		return "", fmt.Errorf("weather service returned an empty response")
+	}
+	return weather, nil
+}
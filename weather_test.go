@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWeatherAppearsInPrompt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/San Francisco" || r.URL.Query().Get("format") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("Sunny, +18°C\n"))
+	}))
+	defer srv.Close()
+	t.Setenv("INCLUDE_WEATHER", "true")
+	t.Setenv("WEATHER_URL", srv.URL)
+	stub := newOllamaStub(t, reply("Try the patio at The Gourmet Spot."))
+
+	resp := decodeJSON(t, postChatCompletion(t, `{"location": "San Francisco"}`))
+	if prompt := stub.received()[0].Messages[0].Content; !strings.Contains(prompt, "Current weather there: Sunny, +18°C.") {
+		t.Errorf("prompt lacks the weather line:\n%s", prompt)
+	}
+	if _, ok := resp["warnings"]; ok {
+		t.Errorf("warnings = %v, want none", resp["warnings"])
+	}
+}
+
+func TestWeatherFailureOnlyWarns(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	t.Setenv("INCLUDE_WEATHER", "true")
+	t.Setenv("WEATHER_URL", srv.URL)
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+
+	rec := postChatCompletion(t, `{"location": "San Francisco"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	warnings, _ := decodeJSON(t, rec)["warnings"].([]interface{})
+	if len(warnings) != 1 || warnings[0] != "current weather unavailable" {
+		t.Errorf("warnings = %v, want the weather reported unavailable", warnings)
+	}
+	if prompt := stub.received()[0].Messages[0].Content; strings.Contains(prompt, "weather") {
+		t.Errorf("prompt mentions weather after a failed lookup:\n%s", prompt)
+	}
+}
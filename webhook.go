@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// validationRequest is what the VALIDATE_WEBHOOK_URL service receives for each chat request.
+type validationRequest struct {
+	Location   string          `json:"location"`
+	Query      string          `json:"query"`
+	Model      string          `json:"model,omitempty"`
+	Profile    string          `json:"profile,omitempty"`
+	User       string          `json:"user,omitempty"` // hashed with hashUser, like in the logs
+	RemoteAddr string          `json:"remote_addr"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+}
+
+// validateRequest asks the VALIDATE_WEBHOOK_URL service, if configured, whether reqData may
+// proceed. A non-2xx answer rejects the request with 403. When the service can't be reached
+// within VALIDATE_WEBHOOK_TIMEOUT (default 1s), the request is rejected with 503 unless
+// VALIDATE_WEBHOOK_FAIL_OPEN=true lets it through.
+func validateRequest(ctx context.Context, reqData RequestBody, remoteAddr string) error {
+	endpoint := os.Getenv("VALIDATE_WEBHOOK_URL")
+	if endpoint == "" {
+		return nil
+	}
+	payload := validationRequest{
+		Location:   reqData.Location,
+		Query:      reqData.Query,
+		Model:      reqData.Model,
+		Profile:    reqData.Profile,
+		RemoteAddr: remoteAddr,
+		Metadata:   reqData.Metadata,
+	}
+	if reqData.User != "" {
+		payload.User = hashUser(reqData.User)
+	}
+
+	status, err := postValidation(ctx, endpoint, payload)
+	if err != nil {
+		if envBool("VALIDATE_WEBHOOK_FAIL_OPEN") {
+			log.Printf("Validation webhook failed (%v), allowing request", err)
+			return nil
+		}
+		return &httpError{Status: http.StatusServiceUnavailable, Message: "Request validation unavailable", Err: err}
+	}
+	if status < 200 || status > 299 {
+		return &httpError{Status: http.StatusForbidden, Message: "Request rejected by validation"}
+	}
+	return nil
+}
+
+// postValidation sends payload to endpoint and returns the response status.
+func postValidation(ctx context.Context, endpoint string, payload validationRequest) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, envDuration("VALIDATE_WEBHOOK_TIMEOUT", time.Second))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid VALIDATE_WEBHOOK_URL %q: %w", endpoint, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096)) // drain so the connection can be reused
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newWebhookStub starts a validation service that approves requests whose query isn't
+// "forbidden", recording what it receives, and points VALIDATE_WEBHOOK_URL at it.
+func newWebhookStub(t *testing.T) *[]validationRequest {
+	t.Helper()
+	var received []validationRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v validationRequest
+		json.NewDecoder(r.Body).Decode(&v)
+		received = append(received, v)
+		if v.Query == "forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("VALIDATE_WEBHOOK_URL", srv.URL)
+	return &received
+}
+
+func TestWebhookApproves(t *testing.T) {
+	received := newWebhookStub(t)
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	rec := postChatCompletion(t, `{"location": "San Francisco", "query": "dinner", "user": "alice", "metadata": {"k": "v"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(*received) != 1 {
+		t.Fatalf("webhook called %d times, want 1", len(*received))
+	}
+	v := (*received)[0]
+	if v.Location != "San Francisco" || v.Query != "dinner" || v.User != hashUser("alice") || string(v.Metadata) != `{"k":"v"}` {
+		t.Errorf("webhook received %+v", v)
+	}
+	if len(stub.received()) != 1 {
+		t.Error("approved request did not reach Ollama")
+	}
+}
+
+func TestWebhookDenies(t *testing.T) {
+	newWebhookStub(t)
+	stub := newOllamaStub(t, reply("Try Fancy Eats."))
+	if rec := postChatCompletion(t, `{"location": "San Francisco", "query": "forbidden"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("status %d, want 403", rec.Code)
+	}
+	if len(stub.received()) != 0 {
+		t.Error("denied request reached Ollama")
+	}
+}
+
+func TestWebhookUnreachable(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	t.Setenv("VALIDATE_WEBHOOK_URL", slow.URL)
+	t.Setenv("VALIDATE_WEBHOOK_TIMEOUT", "20ms")
+	newOllamaStub(t, reply("Try Fancy Eats."))
+
+	if rec := postChatCompletion(t, `{"location": "San Francisco"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("fail closed: status %d, want 503", rec.Code)
+	}
+	t.Setenv("VALIDATE_WEBHOOK_FAIL_OPEN", "true")
+	if rec := postChatCompletion(t, `{"location": "San Francisco"}`); rec.Code != http.StatusOK {
+		t.Errorf("fail open: status %d, want 200", rec.Code)
+	}
+}